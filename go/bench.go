@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Outcomes of a single benchmark operation.
+const (
+	outcomeOK        = "ok"
+	outcomeNotFound  = "not_found"
+	outcomeThrottled = "throttled"
+	outcomeError     = "error"
+	outcomeTimeout   = "timeout"
+	outcomeCanceled  = "canceled"
+)
+
+// benchConfig describes a read benchmark run.
+type benchConfig struct {
+	Ops           int
+	Concurrency   int
+	Distribution  string
+	Keys          int
+	Seed          uint64
+	Decode        string
+	ValueSize     int
+	OpTimeout     time.Duration
+	ShutdownGrace time.Duration
+	ResultsPath   string
+	Profiles      profiles
+}
+
+// benchConfigFromEnv reads the benchmark configuration from the environment.
+// It provides the defaults of the bench command's flags.
+func benchConfigFromEnv() (cfg benchConfig, err error) {
+	cfg = benchConfig{
+		Distribution: DistributionUniform,
+		Decode:       DecodeLazy,
+		ResultsPath:  os.Getenv("COSMOS_BENCH_RESULTS"),
+	}
+	if d, set := os.LookupEnv("COSMOS_KEY_DISTRIBUTION"); set {
+		cfg.Distribution = d
+	}
+	if d, set := os.LookupEnv("COSMOS_DECODE"); set {
+		cfg.Decode = d
+	}
+	if cfg.Ops, err = envInt("COSMOS_BENCH_OPS", 1000); err != nil {
+		return cfg, err
+	}
+	if cfg.Concurrency, err = envInt("COSMOS_BENCH_CONCURRENCY", 1); err != nil {
+		return cfg, err
+	}
+	if cfg.Keys, err = envInt("COSMOS_KEY_COUNT", 1000); err != nil {
+		return cfg, err
+	}
+	if cfg.ValueSize, err = envInt("COSMOS_FIXTURE_VALUE_SIZE", 128); err != nil {
+		return cfg, err
+	}
+	if cfg.ShutdownGrace, err = envDuration("COSMOS_SHUTDOWN_GRACE", 10*time.Second); err != nil {
+		return cfg, err
+	}
+	seed, err := envInt("COSMOS_SEED", 1)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Seed = uint64(seed)
+	return cfg, nil
+}
+
+// registerFlags registers flags that override cfg.
+func (cfg *benchConfig) registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&cfg.Ops, "ops", cfg.Ops, "issue `n` point reads")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "run `n` concurrent readers")
+	fs.StringVar(&cfg.Distribution, "distribution", cfg.Distribution, "draw keys from `distribution`: uniform, zipfian, hotspot, sequential or latest")
+	fs.IntVar(&cfg.Keys, "keys", cfg.Keys, "read from a key space of `n` keys")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "`seed` of the key space and the key sequence")
+	fs.IntVar(&cfg.ValueSize, "value-size", cfg.ValueSize, "seed values of `bytes` bytes")
+	fs.StringVar(&cfg.Decode, "decode", cfg.Decode, "decode items as `lazy` or json")
+	fs.StringVar(&cfg.ResultsPath, "results", cfg.ResultsPath, "write the report as JSON to `file`")
+	fs.DurationVar(&cfg.ShutdownGrace, "shutdown-grace", cfg.ShutdownGrace, "let in-flight reads finish for `duration` after the run is stopped")
+	fs.StringVar(&cfg.Profiles.CPU, "cpuprofile", "", "write a CPU profile of the benchmark reads to `file`")
+	fs.StringVar(&cfg.Profiles.Heap, "memprofile", "", "write a heap profile taken after the benchmark reads to `file`")
+	fs.StringVar(&cfg.Profiles.Allocs, "allocprofile", "", "write a profile of all allocations since the program started, seeding included, to `file`")
+	// The sampling rate applies to allocations made after it is set, so it
+	// is set as the flag is parsed, before the client is created.
+	fs.Func("memprofilerate", "set runtime.MemProfileRate to `rate` (1 records every allocation)", func(s string) error {
+		rate, err := strconv.Atoi(s)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("rate must be a positive integer")
+		}
+		runtime.MemProfileRate = rate
+		return nil
+	})
+}
+
+// validate checks a configuration assembled from the environment and flags.
+func (cfg benchConfig) validate() error {
+	if _, ok := valueDecoders[cfg.Decode]; !ok {
+		return fmt.Errorf("unknown decoding %q", cfg.Decode)
+	}
+	if cfg.Ops <= 0 || cfg.Concurrency <= 0 || cfg.Keys <= 0 {
+		return fmt.Errorf("ops, concurrency and keys must be positive")
+	}
+	if cfg.ValueSize < 0 {
+		return fmt.Errorf("value size must not be negative")
+	}
+	return nil
+}
+
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	s, ok := os.LookupEnv(name)
+	if !ok || s == "" {
+		return def, nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return v, nil
+}
+
+func envInt(name string, def int) (int, error) {
+	s, ok := os.LookupEnv(name)
+	if !ok || s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return v, nil
+}
+
+// sample is the measurement of one operation.
+type sample struct {
+	Key     string
+	Latency time.Duration
+	Outcome string
+}
+
+// runBenchmark seeds a run-unique fixture set, runs the read benchmark against
+// it and deletes the fixtures again. The run stops early when ctx is done; the
+// fixtures are still deleted. Once the reads have started, stopping early
+// still yields a report of the work done so far, marked incomplete.
+func runBenchmark(ctx context.Context, containerClient *azcosmos.ContainerClient, cfg benchConfig) (benchReport, error) {
+	store := NewKeyValueStore(containerClient, newFixtureStoreID())
+	store.decodeValue = valueDecoders[cfg.Decode]
+	space := KeySpace{Seed: cfg.Seed, Size: cfg.Keys}
+	defer func() {
+		log.Printf("Deleting fixtures in store %s", store.StoreID())
+		if err := teardownFixtures(context.WithoutCancel(ctx), store, cfg.Concurrency, cfg.OpTimeout); err != nil {
+			log.Printf("Failed to delete fixtures in store %s: %v", store.StoreID(), err)
+		}
+	}()
+
+	log.Printf("Seeding %d fixtures in store %s", space.Size, store.StoreID())
+	if err := seedFixtures(ctx, store, space, cfg.ValueSize, cfg.Concurrency, cfg.OpTimeout); err != nil {
+		return benchReport{}, fmt.Errorf("seed fixtures: %w", err)
+	}
+	if err := verifyFixtures(ctx, store, space, cfg.OpTimeout); err != nil {
+		return benchReport{}, fmt.Errorf("verify fixtures: %w", err)
+	}
+	return runReadBenchmark(ctx, store, space, cfg)
+}
+
+// runReadBenchmark issues cfg.Ops reads spread over cfg.Concurrency workers,
+// choosing keys from the configured distribution. Each read is bounded by
+// cfg.OpTimeout.
+//
+// When ctx is done no new reads are issued, and reads in flight get
+// cfg.ShutdownGrace to finish before they are canceled. The report then
+// covers the reads issued so far and is marked incomplete.
+func runReadBenchmark(ctx context.Context, store *KeyValueStore, space KeySpace, cfg benchConfig) (benchReport, error) {
+	gen, err := NewKeyGenerator(cfg.Distribution, space, cfg.Seed)
+	if err != nil {
+		return benchReport{}, err
+	}
+
+	// In-flight reads outlive ctx by the grace period.
+	opsCtx, cancelOps := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelOps()
+	stopDrain := context.AfterFunc(ctx, func() {
+		log.Printf("Stopping benchmark, draining in-flight reads for up to %s", cfg.ShutdownGrace)
+		time.AfterFunc(cfg.ShutdownGrace, cancelOps)
+	})
+	defer stopDrain()
+
+	stopProfiles, err := cfg.Profiles.start()
+	if err != nil {
+		return benchReport{}, err
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	samples := make([]sample, cfg.Ops)
+	start := time.Now()
+	err = forEachIndex(ctx, cfg.Ops, cfg.Concurrency, func(i int) error {
+		key := gen.Next()
+		opCtx, cancel := opContext(opsCtx, cfg.OpTimeout)
+		defer cancel()
+		opStart := time.Now()
+		_, found, err := store.Get(opCtx, key)
+		samples[i] = sample{Key: key, Latency: time.Since(opStart), Outcome: classify(opsCtx, opCtx, found, err)}
+		return nil
+	})
+	elapsed := time.Since(start)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if err := stopProfiles(); err != nil {
+		return benchReport{}, err
+	}
+
+	report := summarize(cfg, samples, elapsed)
+	if report.Ops > 0 {
+		report.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(report.Ops)
+		report.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(report.Ops)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		report.Incomplete, report.StopReason = true, "run timeout reached"
+	case errors.Is(err, context.Canceled):
+		report.Incomplete, report.StopReason = true, "interrupted"
+	case err != nil:
+		return benchReport{}, err
+	}
+	return report, nil
+}
+
+// opContext bounds a single operation by timeout. A zero timeout leaves the
+// operation bounded only by ctx.
+func opContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// classify maps the result of a read to its outcome. An operation cut short
+// because runCtx ended is canceled rather than timed out.
+func classify(runCtx, opCtx context.Context, found bool, err error) string {
+	switch {
+	case err == nil && found:
+		return outcomeOK
+	case err == nil:
+		return outcomeNotFound
+	case runCtx.Err() != nil:
+		return outcomeCanceled
+	case errors.Is(opCtx.Err(), context.DeadlineExceeded):
+		return outcomeTimeout
+	case isThrottled(err):
+		return outcomeThrottled
+	default:
+		return outcomeError
+	}
+}
+
+// benchReport summarises a benchmark run.
+type benchReport struct {
+	Incomplete   bool           `json:"incomplete"`
+	StopReason   string         `json:"stop_reason,omitempty"`
+	Distribution string         `json:"distribution"`
+	Decode       string         `json:"decode"`
+	Concurrency  int            `json:"concurrency"`
+	Seed         uint64         `json:"seed"`
+	RequestedOps int            `json:"requested_ops"`
+	Ops          int            `json:"ops"`
+	Elapsed      time.Duration  `json:"elapsed_ns"`
+	Outcomes     map[string]int `json:"outcomes"`
+	DistinctKeys int            `json:"distinct_keys"`
+	P50          time.Duration  `json:"p50_ns"`
+	P95          time.Duration  `json:"p95_ns"`
+	P99          time.Duration  `json:"p99_ns"`
+	Max          time.Duration  `json:"max_ns"`
+	AllocsPerOp  float64        `json:"allocs_per_op"`
+	BytesPerOp   float64        `json:"bytes_per_op"`
+}
+
+func summarize(cfg benchConfig, samples []sample, elapsed time.Duration) benchReport {
+	r := benchReport{
+		Distribution: cfg.Distribution,
+		Decode:       cfg.Decode,
+		Concurrency:  cfg.Concurrency,
+		Seed:         cfg.Seed,
+		RequestedOps: cfg.Ops,
+		Elapsed:      elapsed,
+		Outcomes:     map[string]int{},
+	}
+	var latencies []time.Duration
+	keys := map[string]struct{}{}
+	for _, s := range samples {
+		if s.Outcome == "" {
+			// Never issued because the run ended early.
+			continue
+		}
+		r.Ops++
+		r.Outcomes[s.Outcome]++
+		keys[s.Key] = struct{}{}
+		if s.Outcome != outcomeCanceled {
+			latencies = append(latencies, s.Latency)
+		}
+	}
+	r.DistinctKeys = len(keys)
+	slices.Sort(latencies)
+	r.P50 = percentile(latencies, 0.50)
+	r.P95 = percentile(latencies, 0.95)
+	r.P99 = percentile(latencies, 0.99)
+	r.Max = percentile(latencies, 1)
+	return r
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func (r benchReport) print(w io.Writer) {
+	if r.Incomplete {
+		fmt.Fprintf(w, "[BENCH] INCOMPLETE (%s): %d of %d reads issued\n", r.StopReason, r.Ops, r.RequestedOps)
+	}
+	fmt.Fprintf(w, "[BENCH] %d reads, %s distribution, concurrency %d, seed %d\n", r.Ops, r.Distribution, r.Concurrency, r.Seed)
+	fmt.Fprintf(w, "[BENCH] elapsed %s, %.1f ops/s, %d distinct keys\n", r.Elapsed, float64(r.Ops)/r.Elapsed.Seconds(), r.DistinctKeys)
+	fmt.Fprintf(w, "[BENCH] p50 %s, p95 %s, p99 %s, max %s\n", r.P50, r.P95, r.P99, r.Max)
+	fmt.Fprintf(w, "[BENCH] %.0f allocs/op, %.0f B/op with %s decoding\n", r.AllocsPerOp, r.BytesPerOp, r.Decode)
+	for _, o := range slices.Sorted(maps.Keys(r.Outcomes)) {
+		fmt.Fprintf(w, "[BENCH] %s: %d\n", o, r.Outcomes[o])
+	}
+}
+
+// writeResults stores the report as JSON at path.
+func (r benchReport) writeResults(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// slowWrites delays the first n item writes it sends by delay, or until
+// their request is canceled.
+type slowWrites struct {
+	delay time.Duration
+	n     atomic.Int32
+}
+
+func (s *slowWrites) Do(req *http.Request) (*http.Response, error) {
+	isWrite := req.Method == http.MethodPost && req.Header.Get("Content-Type") != "application/query+json"
+	if isWrite && s.n.Add(-1) >= 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestSeedFixturesRetriesATimeout(t *testing.T) {
+	ctx := testContext(t)
+	slow := &slowWrites{delay: time.Second}
+	container := fakeClient(t, fakeServer(t, nil, "test"), "test", &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: slow}})
+	space := KeySpace{Seed: 1, Size: 5}
+
+	// One slow write is retried.
+	slow.n.Store(1)
+	store := NewKeyValueStore(container, "seed-once")
+	if err := seedFixtures(ctx, store, space, 16, 1, 50*time.Millisecond); err != nil {
+		t.Fatalf("seedFixtures with one slow write: %v", err)
+	}
+	if err := verifyFixtures(ctx, store, space, 0); err != nil {
+		t.Error(err)
+	}
+
+	// A write that times out again fails the seed, naming the key.
+	slow.n.Store(2)
+	store = NewKeyValueStore(container, "seed-twice")
+	err := seedFixtures(ctx, store, space, 16, 1, 50*time.Millisecond)
+	want := "write " + space.Key(0) + ": timed out twice after 50ms"
+	if err == nil || err.Error() != want {
+		t.Errorf("seedFixtures with a write slow twice: error = %v, want %q", err, want)
+	}
+}
+
+// benchStore returns a store seeded with the keys of space whose reads go
+// through a FaultTransport injecting spec.
+func benchStore(t *testing.T, spec string, space KeySpace) *KeyValueStore {
+	t.Helper()
+	store, sw := faultyStore(t, spec)
+	if err := seedFixtures(testContext(t), store, space, 16, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	sw.on.Store(true)
+	return store
+}
+
+// readResults runs writeResults of r and decodes the file it wrote.
+func readResults(t *testing.T, r benchReport) map[string]any {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "results.json")
+	if err := r.writeResults(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results map[string]any
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestRunReadBenchmark(t *testing.T) {
+	space := KeySpace{Seed: 1, Size: 10}
+	cfg := benchConfig{
+		Ops:           20,
+		Concurrency:   2,
+		Distribution:  DistributionUniform,
+		Keys:          space.Size,
+		Seed:          1,
+		Decode:        DecodeLazy,
+		ShutdownGrace: time.Second,
+	}
+	tests := []struct {
+		name string
+		// faults injected into the reads.
+		faults    string
+		opTimeout time.Duration
+		grace     time.Duration
+		// stopAfter stops the run when it has lasted that long; runTimeout
+		// stops it with a deadline instead.
+		stopAfter, runTimeout time.Duration
+		wantOps               int
+		wantOutcomes          map[string]int
+		wantStopReason        string
+	}{
+		{name: "ok", faults: "latency=fixed:1ms", wantOps: 20, wantOutcomes: map[string]int{outcomeOK: 20}},
+		// Reads slower than -timeout time out, and the run carries on.
+		{name: "timeouts", faults: "latency=fixed:200ms", opTimeout: 20 * time.Millisecond, wantOps: 20, wantOutcomes: map[string]int{outcomeTimeout: 20}},
+		{name: "throttled", faults: "429=1,retry-after=1ms", wantOps: 20, wantOutcomes: map[string]int{outcomeThrottled: 20}},
+		// A stop waits for the reads in flight, up to the shutdown grace.
+		{name: "interrupted within the grace", faults: "latency=fixed:200ms", grace: time.Second, stopAfter: 50 * time.Millisecond,
+			wantOps: 2, wantOutcomes: map[string]int{outcomeOK: 2}, wantStopReason: "interrupted"},
+		{name: "interrupted past the grace", faults: "latency=fixed:500ms", grace: 50 * time.Millisecond, stopAfter: 50 * time.Millisecond,
+			wantOps: 2, wantOutcomes: map[string]int{outcomeCanceled: 2}, wantStopReason: "interrupted"},
+		{name: "run timeout", faults: "latency=fixed:200ms", grace: time.Second, runTimeout: 50 * time.Millisecond,
+			wantOps: 2, wantOutcomes: map[string]int{outcomeOK: 2}, wantStopReason: "run timeout reached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := benchStore(t, tt.faults, space)
+			cfg := cfg
+			cfg.OpTimeout = tt.opTimeout
+			if tt.grace > 0 {
+				cfg.ShutdownGrace = tt.grace
+			}
+			ctx, cancel := context.WithCancel(testContext(t))
+			defer cancel()
+			if tt.stopAfter > 0 {
+				time.AfterFunc(tt.stopAfter, cancel)
+			}
+			if tt.runTimeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.runTimeout)
+				defer cancel()
+			}
+
+			report, err := runReadBenchmark(ctx, store, space, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Ops != tt.wantOps || !maps.Equal(report.Outcomes, tt.wantOutcomes) {
+				t.Errorf("%d reads with outcomes %v, want %d with %v", report.Ops, report.Outcomes, tt.wantOps, tt.wantOutcomes)
+			}
+			if report.Incomplete != (tt.wantStopReason != "") || report.StopReason != tt.wantStopReason {
+				t.Errorf("incomplete %v, stop reason %q; want %q", report.Incomplete, report.StopReason, tt.wantStopReason)
+			}
+
+			results := readResults(t, report)
+			if results["incomplete"] != report.Incomplete || results["requested_ops"] != float64(cfg.Ops) || results["ops"] != float64(tt.wantOps) {
+				t.Errorf("results file has incomplete %v, requested_ops %v, ops %v; want %v, %d, %d",
+					results["incomplete"], results["requested_ops"], results["ops"], report.Incomplete, cfg.Ops, tt.wantOps)
+			}
+			if reason, ok := results["stop_reason"]; ok != (tt.wantStopReason != "") || ok && reason != tt.wantStopReason {
+				t.Errorf("results file has stop_reason %v, want %q", reason, tt.wantStopReason)
+			}
+			outcomes, _ := results["outcomes"].(map[string]any)
+			for outcome, n := range tt.wantOutcomes {
+				if outcomes[outcome] != float64(n) {
+					t.Errorf("results file has outcomes %v, want %v", outcomes, tt.wantOutcomes)
+					break
+				}
+			}
+
+			var printed strings.Builder
+			report.print(&printed)
+			if incomplete := strings.Contains(printed.String(), "INCOMPLETE ("+tt.wantStopReason+")"); incomplete != report.Incomplete {
+				t.Errorf("printed report:\n%s\nwant it marked incomplete: %v", printed.String(), report.Incomplete)
+			}
+		})
+	}
+}
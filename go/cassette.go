@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// redactedHeaders are replaced before an interaction is written to a cassette.
+var redactedHeaders = []string{"Authorization"}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the recorded form of an http.Request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the recorded form of an http.Response.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// RecordingTransport sends requests with next and appends every interaction
+// to a cassette file, one JSON object per line. Appending as it goes means an
+// interrupted run still leaves a usable cassette.
+type RecordingTransport struct {
+	next policy.Transporter
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecordingTransport creates or truncates the cassette at path. A nil next
+// uses http.DefaultClient.
+func NewRecordingTransport(path string, next policy.Transporter) (*RecordingTransport, error) {
+	if next == nil {
+		next = http.DefaultClient
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordingTransport{next: next, file: file}, nil
+}
+
+// Do implements policy.Transporter.
+func (t *RecordingTransport) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	original := resp.Body
+	respBody, err := drainBody(&resp.Body)
+	original.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	header := req.Header.Clone()
+	for _, h := range redactedHeaders {
+		if header.Get(h) != "" {
+			header.Set(h, "REDACTED")
+		}
+	}
+	line, err := json.Marshal(Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: header,
+			Body:   string(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       string(respBody),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("write cassette: %w", err)
+	}
+	return resp, nil
+}
+
+// Close closes the cassette file.
+func (t *RecordingTransport) Close() error {
+	return t.file.Close()
+}
+
+// ReplayTransport serves responses from a cassette without touching the
+// network. Each request gets the response of the first interaction not yet
+// replayed with the same method, URL and body, so requests may arrive in any
+// order, as those of concurrent commands do, but each only as often as it was
+// recorded. Account reads are the exception: the SDK issues them whenever it
+// refreshes its view of the account, so once their recorded responses are used
+// up they keep getting the last one.
+type ReplayTransport struct {
+	mu        sync.Mutex
+	responses map[string][]RecordedResponse
+	served    map[string]int
+}
+
+// NewReplayTransport loads the cassette at path.
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t := &ReplayTransport{
+		responses: map[string][]RecordedResponse{},
+		served:    map[string]int{},
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var i Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		key := replayKey(i.Request.Method, i.Request.URL, i.Request.Body)
+		t.responses[key] = append(t.responses[key], i.Response)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Do implements policy.Transporter.
+func (t *ReplayTransport) Do(req *http.Request) (*http.Response, error) {
+	body, err := drainBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	key := replayKey(req.Method, req.URL.String(), string(body))
+
+	t.mu.Lock()
+	responses, n := t.responses[key], t.served[key]
+	switch {
+	case len(responses) == 0:
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction for %s %s", req.Method, req.URL)
+	case n == len(responses) && !isAccountRead(req.Method, req.URL.String()):
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%s %s was recorded %d times and every one has been replayed", req.Method, req.URL, n)
+	}
+	recorded := responses[min(n, len(responses)-1)]
+	t.served[key]++
+	t.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// isAccountRead reports whether a request reads the account, the root of its
+// endpoint.
+func isAccountRead(method, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && method == http.MethodGet && (u.Path == "" || u.Path == "/")
+}
+
+func replayKey(method, url, body string) string {
+	return method + " " + url + "\n" + body
+}
+
+// drainBody reads *body fully and replaces it with an in-memory copy. The
+// original body is left open; request bodies belong to the pipeline, which
+// rewinds them on retry.
+func drainBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
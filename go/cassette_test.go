@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"example/cosmos/fakecosmos"
+)
+
+var updateCassettes = flag.Bool("update", false, "record the cassettes in testdata again, against the fake")
+
+// storeCassette is a recording of cassetteSession against the fake, served as
+// if from cassetteEndpoint.
+const (
+	storeCassette    = "testdata/store.cassette"
+	cassetteEndpoint = "https://cassette.documents.azure.com:443/"
+)
+
+// cassetteSession is what storeCassette recorded: the results of a fixed
+// series of store calls and a query.
+type cassetteSession struct {
+	get       []byte
+	keys      []string
+	queried   []string
+	afterSet  bool
+	afterDrop bool
+}
+
+var wantCassetteSession = cassetteSession{
+	get:      []byte("v1"),
+	keys:     []string{"a", "b"},
+	queried:  []string{"b"},
+	afterSet: true,
+}
+
+// runCassetteSession makes the store calls recorded in storeCassette.
+func runCassetteSession(ctx context.Context, t *testing.T, store *KeyValueStore) cassetteSession {
+	t.Helper()
+	var s cassetteSession
+	var err error
+	if err := store.Set(ctx, "a", []byte("v1")); err != nil {
+		t.Fatalf("Set(a): %v", err)
+	}
+	if err := store.Set(ctx, "b", []byte("v2")); err != nil {
+		t.Fatalf("Set(b): %v", err)
+	}
+	if s.get, _, err = store.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get(a): %v", err)
+	}
+	if s.keys, err = store.GetKeys(ctx); err != nil {
+		t.Fatalf("GetKeys(): %v", err)
+	}
+	slices.Sort(s.keys)
+	query := "SELECT * FROM c WHERE c.store_id = @store_id AND c.id > @after"
+	o := azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@store_id", Value: store.StoreID()}, {Name: "@after", Value: "a"}}}
+	for doc, err := range QueryItems[Document](ctx, store.client, query, store.pk, &o) {
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		s.queried = append(s.queried, doc.ID)
+	}
+	if s.afterSet, err = store.Exists(ctx, "a"); err != nil {
+		t.Fatalf("Exists(a): %v", err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete(a): %v", err)
+	}
+	if s.afterDrop, err = store.Exists(ctx, "a"); err != nil {
+		t.Fatalf("Exists(a) after Delete: %v", err)
+	}
+	return s
+}
+
+// cassetteStore returns the store of storeCassette, sending requests with
+// transport.
+func cassetteStore(t *testing.T, transport policy.Transporter) *KeyValueStore {
+	t.Helper()
+	cred, err := azcosmos.NewKeyCredential(fakecosmos.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replay errors are final, so retrying them only slows the tests down.
+	o := &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
+		Transport: transport,
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	}}
+	client, err := azcosmos.NewClientWithKey(cassetteEndpoint, cred, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, err := client.NewContainer("cassette", "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKeyValueStore(container, "cassette")
+}
+
+// recordingStore returns the store of storeCassette in a new fake, recording
+// its requests to path.
+func recordingStore(t *testing.T, path string) *KeyValueStore {
+	t.Helper()
+	srv := fakeServer(t, nil, "cassette")
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := NewRecordingTransport(path, redirectTransport{target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+	return cassetteStore(t, recorder)
+}
+
+// recordCassette records cassetteSession against a new fake to path.
+func recordCassette(t *testing.T, path string) cassetteSession {
+	t.Helper()
+	return runCassetteSession(testContext(t), t, recordingStore(t, path))
+}
+
+// redirectTransport sends requests to the host of target instead of their
+// own, keeping their Host header, so that a cassette recorded against the fake
+// names a stable endpoint.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (r redirectTransport) Do(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme, out.URL.Host, out.Host = r.target.Scheme, r.target.Host, req.URL.Host
+	resp, err := http.DefaultClient.Do(out)
+	if resp != nil {
+		resp.Request = req
+	}
+	return resp, err
+}
+
+func TestReplayCassette(t *testing.T) {
+	if *updateCassettes {
+		recordCassette(t, storeCassette)
+	}
+	replay, err := NewReplayTransport(storeCassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+	got := runCassetteSession(ctx, t, cassetteStore(t, replay))
+	if !cassetteSessionsEqual(got, wantCassetteSession) {
+		t.Errorf("replayed session = %+v, want %+v", got, wantCassetteSession)
+	}
+}
+
+func TestReplayRejectsUnrecordedRequests(t *testing.T) {
+	ctx := testContext(t)
+
+	t.Run("missing", func(t *testing.T) {
+		replay, err := NewReplayTransport(storeCassette)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := cassetteStore(t, replay)
+		_, _, err = store.Get(ctx, "never-written")
+		if err == nil || !strings.Contains(err.Error(), "no recorded interaction for GET") {
+			t.Errorf("Get of a key not in the cassette: error = %v, want no recorded interaction", err)
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		replay, err := NewReplayTransport(storeCassette)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := cassetteStore(t, replay)
+		runCassetteSession(ctx, t, store)
+		err = store.Set(ctx, "a", []byte("v1"))
+		if err == nil || !strings.Contains(err.Error(), "was recorded 1 times and every one has been replayed") {
+			t.Errorf("Set(a) after the whole cassette: error = %v, want every interaction replayed", err)
+		}
+	})
+}
+
+func TestReplayInAnyOrder(t *testing.T) {
+	ctx := testContext(t)
+	replay, err := NewReplayTransport(storeCassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := cassetteStore(t, replay)
+	// b was written after a.
+	if err := store.Set(ctx, "b", []byte("v2")); err != nil {
+		t.Errorf("Set(b) before Set(a): %v", err)
+	}
+	if err := store.Set(ctx, "a", []byte("v1")); err != nil {
+		t.Errorf("Set(a): %v", err)
+	}
+	// Reads of a get the responses recorded for them in order: two found
+	// before the delete and one missing after it.
+	for i, want := range []bool{true, true, false} {
+		if found, err := store.Exists(ctx, "a"); err != nil || found != want {
+			t.Errorf("read %d of a: found %v, %v; want %v", i+1, found, err, want)
+		}
+	}
+
+	// A concurrent seed sends its writes in a different order every run.
+	path := filepath.Join(t.TempDir(), "seed.cassette")
+	space := KeySpace{Seed: 1, Size: 50}
+	if err := seedFixtures(ctx, recordingStore(t, path), space, 16, 8, 0); err != nil {
+		t.Fatal(err)
+	}
+	if replay, err = NewReplayTransport(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := seedFixtures(ctx, cassetteStore(t, replay), space, 16, 8, 0); err != nil {
+		t.Errorf("replay of a concurrent seed: %v", err)
+	}
+}
+
+func TestRecordingRedactsAuthorization(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.cassette")
+	if got := recordCassette(t, path); !cassetteSessionsEqual(got, wantCassetteSession) {
+		t.Errorf("recorded session = %+v, want %+v", got, wantCassetteSession)
+	}
+
+	for _, path := range []string{path, storeCassette} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		n := 0
+		for scanner.Scan() {
+			var i Interaction
+			if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+				t.Fatal(err)
+			}
+			if got := i.Request.Header.Values("Authorization"); !slices.Equal(got, []string{"REDACTED"}) {
+				t.Errorf("%s: %s %s has Authorization %q, want REDACTED", path, i.Request.Method, i.Request.URL, got)
+			}
+			n++
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Errorf("%s has no interactions", path)
+		}
+	}
+}
+
+func cassetteSessionsEqual(a, b cassetteSession) bool {
+	return string(a.get) == string(b.get) && slices.Equal(a.keys, b.keys) && slices.Equal(a.queried, b.queried) &&
+		a.afterSet == b.afterSet && a.afterDrop == b.afterDrop
+}
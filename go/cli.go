@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	// setup registers the command's own flags and returns the function
+	// that runs it with the remaining arguments.
+	setup func(fs *flag.FlagSet) runFunc
+	// offline is set if the command runs without connecting, with a
+	// session that only holds the connection settings.
+	offline bool
+}
+
+var commands = []command{
+	{"get", "<key>", "print the value of key", setupGet, false},
+	{"set", "<key> [value]", "set key to value, or to standard input", setupSet, false},
+	{"delete", "<key>", "delete key", setupDelete, false},
+	{"exists", "<key>", "report whether key exists", setupExists, false},
+	{"keys", "[prefix]", "list the keys of the store", setupKeys, false},
+	{"query", "<query>", "run a query in the store's partition or across partitions", setupQuery, false},
+	{"bench", "", "run a read benchmark against a fixture store", setupBench, false},
+	{"seed", "", "write deterministic fixtures to the store", setupSeed, false},
+	{"provision", "", "create the database and container", setupProvision, false},
+	{"shell", "", "run an interactive shell on the container", setupShell, false},
+	{"config", "", "print the resolved settings, with the key redacted, and check them", setupConfig, true},
+}
+
+// usageError is returned by a command that was invoked incorrectly.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// parseInterspersed parses flags that may follow positional arguments, as in
+// cosmos query "SELECT ..." -param @id=bar, and returns the positional
+// arguments. Everything after -- is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: cosmos <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun cosmos <command> -h for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		if os.Args[1] != "-h" && os.Args[1] != "-help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "cosmos: unknown command %q\n\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		summary := strings.ToUpper(cmd.summary[:1]) + cmd.summary[1:]
+		fmt.Fprintf(fs.Output(), "Usage: cosmos %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, summary)
+		fs.PrintDefaults()
+	}
+	conn := &connection{}
+	conn.registerFlags(fs)
+	run := cmd.setup(fs)
+	args := parseInterspersed(fs, os.Args[2:])
+	err := conn.resolve(fs)
+	if err == nil && !cmd.offline {
+		err = conn.validate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cosmos %s: invalid configuration:\n%v\n", cmd.name, err)
+		os.Exit(2)
+	}
+
+	// The first interrupt cancels ctx; after that the default signal
+	// behaviour is restored, so a second interrupt exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if conn.runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conn.runTimeout)
+		defer cancel()
+	}
+
+	s, finish := &session{conn: conn, out: os.Stdout, errOut: os.Stderr}, func() {}
+	if !cmd.offline {
+		if s, finish, err = conn.open(); err != nil {
+			log.Fatalf("Failed to connect: %v", err)
+		}
+	}
+	err = run(ctx, s, args)
+	finish()
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(os.Stderr, "cosmos %s: %v\n", cmd.name, err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("cosmos %s: %v", cmd.name, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Command fake-cosmos serves an in-memory or file-backed fake Cosmos DB
+// account on a local port, so separate processes can share its data.
+//
+//	go run ./cmd/fake-cosmos -data fake.log -database cosmos -container items
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example/cosmos/fakecosmos"
+)
+
+var (
+	addr         = flag.String("addr", "127.0.0.1:8081", "listen on `address`")
+	dataPath     = flag.String("data", "", "keep the account in `file` instead of in memory")
+	key          = flag.String("key", fakecosmos.Key, "base64 account `key`")
+	throughput   = flag.Float64("throughput", 0, "provision `RU/s` for each container; 0 is unlimited")
+	emptyPages   = flag.Bool("empty-pages", false, "return an empty page before every page of query results")
+	databaseID   = flag.String("database", "", "create the `database` if it does not exist")
+	containerID  = flag.String("container", "", "create the `container` in -database if it does not exist")
+	partitionKey = flag.String("partition-key", "/store_id", "partition key `path` of -container")
+)
+
+func main() {
+	flag.Parse()
+
+	o := &fakecosmos.Options{
+		Keys:       []string{*key},
+		Throughput: *throughput,
+		EmptyPages: *emptyPages,
+	}
+	account := fakecosmos.NewAccount(o)
+	if *dataPath != "" {
+		var err error
+		if account, err = fakecosmos.Open(*dataPath, o); err != nil {
+			log.Fatalf("Failed to open account: %v", err)
+		}
+	}
+	if *containerID != "" && *databaseID == "" {
+		log.Fatalf("-container requires -database")
+	}
+	if *databaseID != "" {
+		if err := account.CreateDatabase(*databaseID); err != nil {
+			log.Fatalf("Failed to create database: %v", err)
+		}
+	}
+	if *containerID != "" {
+		if err := account.CreateContainer(*databaseID, *containerID, *partitionKey); err != nil {
+			log.Fatalf("Failed to create container: %v", err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: account}
+	log.Printf("Serving fake Cosmos DB at http://%s/", ln.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Server failed: %v", err)
+	}
+	if err := account.Close(); err != nil {
+		log.Fatalf("Failed to close account: %v", err)
+	}
+}
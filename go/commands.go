@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// runFunc runs a command with its remaining arguments.
+type runFunc = func(ctx context.Context, s *session, args []string) error
+
+// keyArg returns the only argument of a command taking a key.
+func keyArg(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", usageError("expected one key")
+	}
+	return args[0], nil
+}
+
+func setupGet(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		key, err := keyArg(args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		value, found, err := s.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("key %s does not exist in store %s", key, s.store.StoreID())
+		}
+		_, err = s.out.Write(value)
+		return err
+	}
+}
+
+func setupSet(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		var value []byte
+		switch len(args) {
+		case 1:
+			var err error
+			if value, err = io.ReadAll(os.Stdin); err != nil {
+				return fmt.Errorf("read value: %w", err)
+			}
+		case 2:
+			value = []byte(args[1])
+		default:
+			return usageError("expected a key and an optional value")
+		}
+		ctx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		return s.store.Set(ctx, args[0], value)
+	}
+}
+
+func setupDelete(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		key, err := keyArg(args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		return s.store.Delete(ctx, key)
+	}
+}
+
+func setupExists(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		key, err := keyArg(args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		found, err := s.store.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, found)
+		return nil
+	}
+}
+
+func setupKeys(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) > 1 {
+			return usageError("expected at most one prefix")
+		}
+		ctx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		keys, err := s.store.GetKeys(ctx)
+		if err != nil {
+			return err
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if len(args) == 0 || strings.HasPrefix(key, args[0]) {
+				fmt.Fprintln(s.out, key)
+			}
+		}
+		return nil
+	}
+}
+
+// queryParams is a repeatable flag of query parameters, each @name=value.
+// A value that is valid JSON is passed as such, so @n=5 is a number and
+// @id=bar, like @id="bar", a string.
+type queryParams []azcosmos.QueryParameter
+
+func (p *queryParams) String() string {
+	var params []string
+	for _, param := range *p {
+		params = append(params, fmt.Sprintf("%s=%v", param.Name, param.Value))
+	}
+	return strings.Join(params, " ")
+}
+
+func (p *queryParams) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || len(name) < 2 || name[0] != '@' {
+		return fmt.Errorf("parameter %q is not of the form @name=value", s)
+	}
+	var v any = value
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err == nil && !dec.More() {
+		v = decoded
+	}
+	*p = append(*p, azcosmos.QueryParameter{Name: name, Value: v})
+	return nil
+}
+
+func setupQuery(fs *flag.FlagSet) runFunc {
+	var params queryParams
+	fs.Var(&params, "param", "bind the query parameter `@name=value`; may be repeated")
+	pk := fs.String("pk", "", "query the partition `key` rather than the store's")
+	cross := fs.Bool("cross-partition", false, "query every partition of the container")
+	maxItems := fs.Int("max-items", 0, "request at most `n` items per page; 0 leaves it to the service")
+	maxPages := fs.Int("max-pages", 0, "stop after `n` pages and print the continuation; 0 reads every page")
+	continuation := fs.String("continuation", "", "resume a query from the continuation `token` printed by -max-pages")
+	format := fs.String("format", FormatJSON, "print results as `format` json, ndjson or table")
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 1 {
+			return usageError("expected one query")
+		}
+		if *cross && *pk != "" {
+			return usageError("-pk and -cross-partition are mutually exclusive")
+		}
+		if *maxItems < 0 || *maxPages < 0 {
+			return usageError("-max-items and -max-pages must not be negative")
+		}
+		out, err := newResultWriter(*format, s.out)
+		if err != nil {
+			return usageError(err.Error())
+		}
+
+		partitionKey := s.store.pk
+		o := azcosmos.QueryOptions{QueryParameters: params}
+		switch {
+		case *cross:
+			// An empty partition key fans the query out to every partition.
+			partitionKey = azcosmos.NewPartitionKey()
+			o.EnableCrossPartitionQuery = cross
+		case *pk != "":
+			partitionKey = azcosmos.NewPartitionKeyString(*pk)
+		}
+		if *maxItems > 0 {
+			o.PageSizeHint = int32(*maxItems)
+		}
+		if *continuation != "" {
+			o.ContinuationToken = continuation
+		}
+
+		start := time.Now()
+		pager := s.container.NewQueryItemsPager(args[0], partitionKey, &o)
+		var items, pages int
+		var charge float32
+		var next *string
+		for pager.More() && (*maxPages == 0 || pages < *maxPages) {
+			opCtx, cancel := opContext(ctx, s.conn.opTimeout)
+			page, err := pager.NextPage(opCtx)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("query page %d: %w", pages+1, err)
+			}
+			for _, item := range page.Items {
+				if err := out.write(item); err != nil {
+					return err
+				}
+			}
+			pages++
+			items += len(page.Items)
+			charge += page.RequestCharge
+			next = page.ContinuationToken
+			fmt.Fprintf(s.errOut, "Page %d: %d items, %.2f RU\n", pages, len(page.Items), page.RequestCharge)
+		}
+		if err := out.flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.errOut, "%d items in %d pages, %.2f RU, %v\n", items, pages, charge, time.Since(start).Round(time.Millisecond))
+		if pager.More() && next != nil {
+			fmt.Fprintf(s.errOut, "Continuation: %s\n", *next)
+		}
+		return nil
+	}
+}
+
+func setupBench(fs *flag.FlagSet) runFunc {
+	cfg, envErr := benchConfigFromEnv()
+	cfg.registerFlags(fs)
+	return func(ctx context.Context, s *session, args []string) error {
+		if envErr != nil {
+			return envErr
+		}
+		if len(args) != 0 {
+			return usageError("unexpected arguments")
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		cfg.OpTimeout = s.conn.opTimeout
+		report, err := runBenchmark(ctx, s.container, cfg)
+		if err != nil {
+			return err
+		}
+		report.print(s.out)
+		if cfg.ResultsPath != "" {
+			if err := report.writeResults(cfg.ResultsPath); err != nil {
+				return fmt.Errorf("write results: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+func setupSeed(fs *flag.FlagSet) runFunc {
+	keys := fs.Int("keys", 1000, "write `n` keys")
+	valueSize := fs.Int("value-size", 128, "write values of `bytes` bytes")
+	seed := fs.Uint64("seed", 1, "`seed` of the key space and values")
+	concurrency := fs.Int("concurrency", 8, "run `n` concurrent writers")
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 0 {
+			return usageError("unexpected arguments")
+		}
+		if *keys <= 0 || *concurrency <= 0 || *valueSize < 0 {
+			return usageError("keys and concurrency must be positive and value size must not be negative")
+		}
+		space := KeySpace{Seed: *seed, Size: *keys}
+		if err := seedFixtures(ctx, s.store, space, *valueSize, *concurrency, s.conn.opTimeout); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Seeded %d keys into store %s\n", space.Size, s.store.StoreID())
+		return nil
+	}
+}
+
+func setupProvision(fs *flag.FlagSet) runFunc {
+	throughput := fs.Int("throughput", 0, "provision `RU/s` of manual throughput for the container")
+	autoscale := fs.Int("autoscale", 0, "provision autoscale throughput of up to `RU/s` for the container")
+	ttl := fs.Int("ttl", 0, "expire items after `seconds` by default; -1 enables per-item ttl only, 0 leaves time to live off")
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 0 {
+			return usageError("unexpected arguments")
+		}
+		if *throughput != 0 && *autoscale != 0 {
+			return usageError("-throughput and -autoscale are mutually exclusive")
+		}
+
+		opCtx, cancel := opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		_, err := s.client.CreateDatabase(opCtx, azcosmos.DatabaseProperties{ID: s.conn.database}, nil)
+		if err := reportCreated(s.out, "database", s.conn.database, err); err != nil {
+			return err
+		}
+
+		db, err := s.client.NewDatabase(s.conn.database)
+		if err != nil {
+			return err
+		}
+		props := azcosmos.ContainerProperties{
+			ID:                     s.conn.container,
+			PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/store_id"}},
+		}
+		if *ttl != 0 {
+			t := int32(*ttl)
+			props.DefaultTimeToLive = &t
+		}
+		o := &azcosmos.CreateContainerOptions{}
+		switch {
+		case *throughput > 0:
+			tp := azcosmos.NewManualThroughputProperties(int32(*throughput))
+			o.ThroughputProperties = &tp
+		case *autoscale > 0:
+			tp := azcosmos.NewAutoscaleThroughputProperties(int32(*autoscale))
+			o.ThroughputProperties = &tp
+		}
+		opCtx, cancel = opContext(ctx, s.conn.opTimeout)
+		defer cancel()
+		_, err = db.CreateContainer(opCtx, props, o)
+		return reportCreated(s.out, "container", s.conn.container, err)
+	}
+}
+
+func setupConfig(fs *flag.FlagSet) runFunc {
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 0 {
+			return usageError("unexpected arguments")
+		}
+		if err := s.conn.printConfig(s.out); err != nil {
+			return err
+		}
+		if err := s.conn.validate(); err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return nil
+	}
+}
+
+// reportCreated prints the outcome of creating a resource to w. A resource
+// that already exists is not an error.
+func reportCreated(w io.Writer, kind, id string, err error) error {
+	if statusCode(err) == http.StatusConflict {
+		fmt.Fprintf(w, "The %s %s already exists\n", kind, id)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create %s %s: %w", kind, id, err)
+	}
+	fmt.Fprintf(w, "Created the %s %s\n", kind, id)
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSession returns a session on store that prints to out and errOut.
+func testSession(store *KeyValueStore, out, errOut io.Writer) *session {
+	return &session{
+		container: store.client,
+		store:     store,
+		conn:      &connection{opTimeout: 30 * time.Second},
+		charges:   &chargeMeter{},
+		out:       out,
+		errOut:    errOut,
+	}
+}
+
+// runCommand runs the named command of the CLI with args on store, as main
+// would, and returns what it printed to standard output and standard error.
+func runCommand(ctx context.Context, t *testing.T, store *KeyValueStore, name string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		t.Fatalf("no command %s", name)
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	run := commands[i].setup(fs)
+	var out, errOut bytes.Buffer
+	err = run(ctx, testSession(store, &out, &errOut), parseInterspersed(fs, args))
+	return out.String(), errOut.String(), err
+}
+
+func TestQueryParams(t *testing.T) {
+	tests := []struct {
+		param string
+		want  any
+	}{
+		{"@n=5", json.Number("5")},
+		{"@x=-1.5e3", json.Number("-1.5e3")},
+		{"@ok=true", true},
+		{"@none=null", nil},
+		{`@id="bar"`, "bar"},
+		{"@id=bar", "bar"},
+		{"@obj={\"k\": [1, \"v\"]}", map[string]any{"k": []any{json.Number("1"), "v"}}},
+		// Values that are not one JSON value stay strings.
+		{"@s=5 6", "5 6"},
+		{"@s={", "{"},
+		{"@s=", ""},
+		{"@eq=a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		var p queryParams
+		if err := p.Set(tt.param); err != nil {
+			t.Errorf("Set(%q): %v", tt.param, err)
+			continue
+		}
+		if len(p) != 1 || !reflect.DeepEqual(p[0].Value, tt.want) {
+			t.Errorf("Set(%q) = %#v, want value %#v", tt.param, p, tt.want)
+		}
+	}
+
+	for _, param := range []string{"n=5", "@n", "@=5", "=5", ""} {
+		var p queryParams
+		if err := p.Set(param); err == nil {
+			t.Errorf("Set(%q) = %#v, want an error", param, p)
+		}
+	}
+
+	// The flag is repeatable and keeps the parameters in order.
+	var p queryParams
+	p.Set("@a=1")
+	p.Set("@b=x")
+	want := queryParams{{Name: "@a", Value: json.Number("1")}, {Name: "@b", Value: "x"}}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("parameters = %#v, want %#v", p, want)
+	}
+	if got := p.String(); got != "@a=1 @b=x" {
+		t.Errorf("String() = %q, want %q", got, "@a=1 @b=x")
+	}
+}
+
+func TestKeyCommands(t *testing.T) {
+	ctx := testContext(t)
+	container, _ := fakeContainer(t)
+	store := NewKeyValueStore(container, "keys")
+	tests := []struct {
+		args []string
+		want string
+		// wantErr is the error, if any.
+		wantErr string
+	}{
+		{[]string{"get", "a"}, "", "key a does not exist in store keys"},
+		{[]string{"exists", "a"}, "false\n", ""},
+		{[]string{"keys"}, "", ""},
+		{[]string{"delete", "a"}, "", ""},
+		{[]string{"set", "a", "one"}, "", ""},
+		{[]string{"set", "ab", "two"}, "", ""},
+		{[]string{"set", "b", "three"}, "", ""},
+		{[]string{"get", "a"}, "one", ""},
+		{[]string{"exists", "a"}, "true\n", ""},
+		{[]string{"keys"}, "a\nab\nb\n", ""},
+		{[]string{"keys", "a"}, "a\nab\n", ""},
+		{[]string{"delete", "a"}, "", ""},
+		{[]string{"get", "a"}, "", "key a does not exist in store keys"},
+		{[]string{"keys"}, "ab\nb\n", ""},
+		{[]string{"get"}, "", "expected one key"},
+		{[]string{"get", "a", "b"}, "", "expected one key"},
+		{[]string{"keys", "a", "b"}, "", "expected at most one prefix"},
+	}
+	for _, tt := range tests {
+		out, _, err := runCommand(ctx, t, store, tt.args[0], tt.args[1:]...)
+		var gotErr string
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if out != tt.want || gotErr != tt.wantErr {
+			t.Errorf("%q printed %q with error %q, want %q with %q", tt.args, out, gotErr, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQueryCommand(t *testing.T) {
+	ctx := testContext(t)
+	container, _ := fakeContainer(t)
+	store := NewKeyValueStore(container, "query")
+	for i := range 5 {
+		if err := store.Set(ctx, fmt.Sprintf("k%d", i), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := NewKeyValueStore(container, "other")
+	if err := other.Set(ctx, "o0", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	const query = "SELECT c.id FROM c ORDER BY c.id"
+	// ids returns the ids of the results printed as ndjson.
+	ids := func(out string) []string {
+		var ids []string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			var item struct{ ID string }
+			if err := json.Unmarshal([]byte(line), &item); err != nil {
+				t.Fatalf("result %q: %v", line, err)
+			}
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"store's partition", []string{query}, []string{"k0", "k1", "k2", "k3", "k4"}},
+		{"parameters", []string{"SELECT c.id FROM c WHERE c.id = @id", "-param", "@id=k3"}, []string{"k3"}},
+		{"other partition", []string{query, "-pk", "other"}, []string{"o0"}},
+		{"cross partition", []string{query, "-cross-partition"}, []string{"k0", "k1", "k2", "k3", "k4", "o0"}},
+	}
+	for _, tt := range tests {
+		out, _, err := runCommand(ctx, t, store, "query", append(tt.args, "-format", FormatNDJSON)...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := ids(out); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ids = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// -max-pages stops early and prints where to resume.
+	out, progress, err := runCommand(ctx, t, store, "query", query, "-format", FormatNDJSON, "-max-items", "2", "-max-pages", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(out); !slices.Equal(got, []string{"k0", "k1"}) {
+		t.Errorf("first page = %q, want k0 and k1", got)
+	}
+	_, token, ok := strings.Cut(progress, "Continuation: ")
+	if !ok || !strings.Contains(progress, "2 items in 1 pages") {
+		t.Fatalf("progress of one page of two:\n%s", progress)
+	}
+	out, progress, err = runCommand(ctx, t, store, "query", query, "-format", FormatNDJSON, "-max-items", "2", "-continuation", strings.TrimSpace(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(out); !slices.Equal(got, []string{"k2", "k3", "k4"}) {
+		t.Errorf("resumed query = %q, want k2 to k4", got)
+	}
+	if strings.Contains(progress, "Continuation") {
+		t.Errorf("a query read to the end printed a continuation:\n%s", progress)
+	}
+
+	// The formats print the same results.
+	formats := map[string]string{
+		FormatJSON:  "[\n  {\n    \"id\": \"k3\"\n  }\n]\n",
+		FormatTable: "id\nk3\n",
+	}
+	for format, want := range formats {
+		out, _, err := runCommand(ctx, t, store, "query", "SELECT c.id FROM c WHERE c.id = 'k3'", "-format", format)
+		if err != nil || out != want {
+			t.Errorf("-format %s printed %q, %v; want %q", format, out, err, want)
+		}
+	}
+
+	usageErrors := [][]string{
+		{query, "-pk", "other", "-cross-partition"},
+		{query, "-max-pages", "-1"},
+		{query, "-format", "yaml"},
+		{},
+		{query, "SELECT 1"},
+	}
+	for _, args := range usageErrors {
+		var usageErr usageError
+		if _, _, err := runCommand(ctx, t, store, "query", args...); !errors.As(err, &usageErr) {
+			t.Errorf("query %q: error = %v, want a usage error", args, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"example/cosmos/fakecosmos"
+)
+
+// A connection setting is taken from, in order of precedence, its flag, its
+// COSMOS_* environment variable, the JSON config file named by -config or
+// COSMOS_CONFIG, and the flag's default. Empty environment variables are
+// ignored.
+
+// connectionSetting names a connection setting in each of its sources.
+type connectionSetting struct {
+	flag string
+	env  string
+	key  string // in the config file
+}
+
+// connectionSettings lists the settings in the order they are resolved,
+// which puts emulator before the endpoint and key it defaults.
+var connectionSettings = []connectionSetting{
+	{"connection-string", "COSMOS_CONNECTION_STRING", "connection_string"},
+	{"emulator", "COSMOS_EMULATOR", "emulator"},
+	{"endpoint", "COSMOS_ENDPOINT", "endpoint"},
+	{"account", "COSMOS_ACCOUNT", "account"},
+	{"key", "COSMOS_AUTH_KEY", "key"},
+	{"ca-file", "COSMOS_CA_FILE", "ca_file"},
+	{"insecure-skip-verify", "COSMOS_INSECURE_SKIP_VERIFY", "insecure_skip_verify"},
+	{"database", "COSMOS_DATABASE", "database"},
+	{"container", "COSMOS_CONTAINER", "container"},
+	{"store", "COSMOS_PARTITION_KEY_STRING", "store"},
+	{"timeout", "COSMOS_OP_TIMEOUT", "timeout"},
+	{"run-timeout", "COSMOS_RUN_TIMEOUT", "run_timeout"},
+}
+
+// The emulator's default endpoint and its well-known key, which -emulator
+// uses unless others are given. The fake serves with the same key.
+const (
+	emulatorEndpoint = "https://localhost:8081/"
+	emulatorKey      = fakecosmos.Key
+)
+
+// resolvedSetting is the value of a setting and where it came from.
+type resolvedSetting struct {
+	name   string
+	value  string
+	source string
+}
+
+// resolve fills in the connection settings that were not given as flags from
+// the environment and then the config file, and records where each came
+// from. In emulator mode, an endpoint and key that are still not set default
+// to the emulator's. fs must have been parsed.
+func (c *connection) resolve(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["config"] {
+		c.configPath = os.Getenv("COSMOS_CONFIG")
+	}
+	file, err := readConfigFile(c.configPath)
+	if err != nil {
+		return err
+	}
+
+	c.resolved = nil
+	for _, s := range connectionSettings {
+		f := fs.Lookup(s.flag)
+		fileValue, inFile := file[s.key]
+		delete(file, s.key)
+		source := "default"
+		switch env := os.Getenv(s.env); {
+		case set[s.flag]:
+			source = "flag -" + s.flag
+		case env != "":
+			if err := f.Value.Set(env); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %v", env, s.env, err)
+			}
+			source = s.env
+		case inFile:
+			if err := f.Value.Set(fileValue); err != nil {
+				return fmt.Errorf("invalid value %q for %s in %s: %v", fileValue, s.key, c.configPath, err)
+			}
+			source = c.configPath
+		case c.emulator && c.connectionString == "" && s.flag == "endpoint":
+			f.Value.Set(emulatorEndpoint)
+			source = "emulator"
+		case c.emulator && c.connectionString == "" && s.flag == "key":
+			f.Value.Set(emulatorKey)
+			source = "emulator"
+		}
+		c.resolved = append(c.resolved, resolvedSetting{name: s.flag, value: f.Value.String(), source: source})
+	}
+	if len(file) > 0 {
+		return fmt.Errorf("%s: unknown settings %q", c.configPath, slices.Sorted(maps.Keys(file)))
+	}
+	return nil
+}
+
+// readConfigFile reads the settings of a JSON config file, an object of
+// strings, numbers and booleans keyed like connectionSettings. It returns
+// nothing if path is empty.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	settings := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var v any
+		json.Unmarshal(value, &v)
+		switch v := v.(type) {
+		case string:
+			settings[key] = v
+		case float64, bool:
+			settings[key] = string(value)
+		default:
+			return nil, fmt.Errorf("%s: %s must be a string, number or boolean", path, key)
+		}
+	}
+	return settings, nil
+}
+
+// validate checks that every setting a command needs is present and valid,
+// naming every way to set those that are missing.
+func (c *connection) validate() error {
+	var errs []error
+	required := func(name, value string) {
+		if value != "" {
+			return
+		}
+		i := slices.IndexFunc(connectionSettings, func(s connectionSetting) bool { return s.flag == name })
+		s := connectionSettings[i]
+		err := fmt.Errorf("%s is not set: use -%s, set %s, or set %q in the config file", name, s.flag, s.env, s.key)
+		switch name {
+		case "account":
+			err = fmt.Errorf("%w; or give an -endpoint, -emulator or a connection string instead", err)
+		case "key":
+			err = fmt.Errorf("%w; or give -emulator or a connection string instead", err)
+		}
+		errs = append(errs, err)
+	}
+	switch {
+	case c.connectionString != "":
+		if _, err := parseConnectionString(c.connectionString); err != nil {
+			errs = append(errs, err)
+		}
+		if c.emulator {
+			errs = append(errs, errors.New("a connection string and emulator are mutually exclusive"))
+		}
+		if c.account != "" || c.key != "" || c.endpoint != "" {
+			errs = append(errs, fmt.Errorf("a connection string replaces the endpoint, account and key, but %s", c.describeSources("endpoint", "account", "key")))
+		}
+	case c.endpoint != "":
+		if err := checkEndpoint(c.endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("endpoint %w", err))
+		}
+		required("key", c.key)
+	default:
+		required("account", c.account)
+		required("key", c.key)
+	}
+	if c.caFile != "" && c.insecureSkipVerify {
+		errs = append(errs, errors.New("ca-file and insecure-skip-verify are mutually exclusive"))
+	}
+	required("database", c.database)
+	required("container", c.container)
+	required("store", c.store)
+	if c.opTimeout < 0 || c.runTimeout < 0 {
+		errs = append(errs, errors.New("timeouts must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// describeSources describes where the named settings that are set came from,
+// as in "account is set by COSMOS_ACCOUNT".
+func (c *connection) describeSources(names ...string) string {
+	var set []string
+	for _, r := range c.resolved {
+		if slices.Contains(names, r.name) && r.value != "" {
+			set = append(set, fmt.Sprintf("%s is set by %s", r.name, r.source))
+		}
+	}
+	return strings.Join(set, " and ")
+}
+
+// printConfig prints the resolved settings and their sources, with the key
+// redacted.
+func (c *connection) printConfig(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if c.configPath != "" {
+		fmt.Fprintf(tw, "config\t%s\t\n", c.configPath)
+	}
+	for _, s := range c.resolved {
+		value := s.value
+		switch {
+		case value == "":
+			value = "(not set)"
+		case s.name == "key":
+			value = "(redacted)"
+		case s.name == "connection-string":
+			value = "(redacted)"
+			if creds, err := parseConnectionString(s.value); err == nil {
+				value = "AccountEndpoint=" + creds.endpoint + ";AccountKey=(redacted)"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.name, value, s.source)
+	}
+	return tw.Flush()
+}
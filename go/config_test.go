@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// resolveConnection resolves the connection settings given by args, the
+// environment variables env and, unless it is empty, a config file holding
+// config. Every other COSMOS_* variable is cleared.
+func resolveConnection(t *testing.T, args []string, env map[string]string, config string) (*connection, error) {
+	t.Helper()
+	for _, s := range connectionSettings {
+		t.Setenv(s.env, env[s.env])
+	}
+	t.Setenv("COSMOS_CONFIG", "")
+	if config != "" {
+		path := filepath.Join(t.TempDir(), "cosmos.json")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("COSMOS_CONFIG", path)
+	}
+	var conn connection
+	fs := flag.NewFlagSet("cosmos", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	conn.registerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return &conn, conn.resolve(fs)
+}
+
+// sourceOf returns the value of the named setting and where it came from.
+func (c *connection) sourceOf(name string) (value, source string) {
+	for _, r := range c.resolved {
+		if r.name == name {
+			return r.value, r.source
+		}
+	}
+	return "", ""
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	const config = `{"account": "file", "database": "filedb", "timeout": "5s", "insecure_skip_verify": true}`
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		config     string
+		setting    string
+		want       string
+		wantSource string
+	}{
+		{"flag over env", []string{"-account", "flag"}, map[string]string{"COSMOS_ACCOUNT": "env"}, config, "account", "flag", "flag -account"},
+		{"env over file", nil, map[string]string{"COSMOS_ACCOUNT": "env"}, config, "account", "env", "COSMOS_ACCOUNT"},
+		{"file over default", nil, nil, config, "account", "file", "config"},
+		{"default", nil, nil, "", "account", "", "default"},
+		{"flag default", nil, nil, config, "store", "cosmos/default", "default"},
+		{"empty env ignored", nil, map[string]string{"COSMOS_DATABASE": ""}, config, "database", "filedb", "config"},
+		{"duration from file", nil, nil, config, "timeout", "5s", "config"},
+		{"duration from env", nil, map[string]string{"COSMOS_OP_TIMEOUT": "1m"}, config, "timeout", "1m0s", "COSMOS_OP_TIMEOUT"},
+		{"bool from file", nil, nil, config, "insecure-skip-verify", "true", "config"},
+		{"bool flag over file", []string{"-insecure-skip-verify=false"}, nil, config, "insecure-skip-verify", "false", "flag -insecure-skip-verify"},
+	}
+	for _, tt := range tests {
+		conn, err := resolveConnection(t, tt.args, tt.env, tt.config)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		value, source := conn.sourceOf(tt.setting)
+		if tt.wantSource == "config" {
+			tt.wantSource = conn.configPath
+		}
+		if value != tt.want || source != tt.wantSource {
+			t.Errorf("%s: %s = %q from %q, want %q from %q", tt.name, tt.setting, value, source, tt.want, tt.wantSource)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		config string
+		want   string
+	}{
+		{"invalid env", map[string]string{"COSMOS_OP_TIMEOUT": "soon"}, "", "COSMOS_OP_TIMEOUT"},
+		{"invalid file value", nil, `{"run_timeout": "soon"}`, "run_timeout"},
+		{"unknown file key", nil, `{"acount": "x"}`, `unknown settings ["acount"]`},
+		{"nested file value", nil, `{"account": {"name": "x"}}`, "must be a string, number or boolean"},
+		{"malformed file", nil, `{"account": `, "cosmos.json"},
+	}
+	for _, tt := range tests {
+		_, err := resolveConnection(t, nil, tt.env, tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const connectionString = "AccountEndpoint=https://acct.documents.azure.com:443/;AccountKey=a2V5"
+	names := map[string]string{"COSMOS_DATABASE": "db", "COSMOS_CONTAINER": "items"}
+	with := func(env map[string]string) map[string]string {
+		m := maps.Clone(names)
+		maps.Copy(m, env)
+		return m
+	}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string // each a line of the error; none if valid
+	}{
+		{"account and key", nil, with(map[string]string{"COSMOS_ACCOUNT": "acct", "COSMOS_AUTH_KEY": "a2V5"}), nil},
+		{"connection string", nil, with(map[string]string{"COSMOS_CONNECTION_STRING": connectionString}), nil},
+		{"emulator", []string{"-emulator"}, names, nil},
+		{"account with no key", nil, with(map[string]string{"COSMOS_ACCOUNT": "acct"}), []string{
+			`key is not set: use -key, set COSMOS_AUTH_KEY, or set "key" in the config file; or give -emulator or a connection string instead`,
+		}},
+		{"nothing set", []string{"-store", ""}, nil, []string{
+			`account is not set: use -account, set COSMOS_ACCOUNT, or set "account" in the config file; or give an -endpoint, -emulator or a connection string instead`,
+			`key is not set: use -key, set COSMOS_AUTH_KEY, or set "key" in the config file; or give -emulator or a connection string instead`,
+			`database is not set: use -database, set COSMOS_DATABASE, or set "database" in the config file`,
+			`container is not set: use -container, set COSMOS_CONTAINER, or set "container" in the config file`,
+			`store is not set: use -store, set COSMOS_PARTITION_KEY_STRING, or set "store" in the config file`,
+		}},
+		{"connection string with account and key", []string{"-key", "a2V5"}, with(map[string]string{"COSMOS_CONNECTION_STRING": connectionString, "COSMOS_ACCOUNT": "acct"}), []string{
+			"a connection string replaces the endpoint, account and key, but account is set by COSMOS_ACCOUNT and key is set by flag -key",
+		}},
+		{"connection string with emulator", []string{"-emulator"}, with(map[string]string{"COSMOS_CONNECTION_STRING": connectionString}), []string{
+			"a connection string and emulator are mutually exclusive",
+		}},
+		{"malformed connection string", nil, with(map[string]string{"COSMOS_CONNECTION_STRING": "AccountKey=a2V5"}), []string{
+			"connection string: AccountEndpoint is missing",
+		}},
+		{"invalid endpoint with no key", []string{"-endpoint", "localhost:8081"}, names, []string{
+			`endpoint "localhost:8081" is not an http or https URL`,
+			`key is not set: use -key, set COSMOS_AUTH_KEY, or set "key" in the config file; or give -emulator or a connection string instead`,
+		}},
+		{"ca file and insecure", []string{"-emulator", "-ca-file", "ca.pem", "-insecure-skip-verify"}, names, []string{
+			"ca-file and insecure-skip-verify are mutually exclusive",
+		}},
+		{"negative timeout", []string{"-emulator", "-timeout", "-1s"}, names, []string{
+			"timeouts must not be negative",
+		}},
+	}
+	for _, tt := range tests {
+		conn, err := resolveConnection(t, tt.args, tt.env, "")
+		if err != nil {
+			t.Errorf("%s: resolve: %v", tt.name, err)
+			continue
+		}
+		err = conn.validate()
+		var got []string
+		if err != nil {
+			got = strings.Split(err.Error(), "\n")
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: validate() =\n%s\nwant:\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+// checkPrintConfig checks that printConfig of the settings given by args and
+// env prints the want lines, compared with their padding collapsed, and
+// never shows key.
+func checkPrintConfig(t *testing.T, name string, args []string, env map[string]string, key string, want []string) {
+	t.Helper()
+	conn, err := resolveConnection(t, args, env, "")
+	if err != nil {
+		t.Errorf("%s: resolve: %v", name, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := conn.printConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), key) {
+		t.Errorf("%s: printConfig shows the key:\n%s", name, buf.String())
+	}
+	lines := map[string]bool{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		lines[strings.Join(strings.Fields(line), "  ")] = true
+	}
+	for _, w := range want {
+		if !lines[strings.Join(strings.Fields(w), "  ")] {
+			t.Errorf("%s: printConfig has no line %q:\n%s", name, w, buf.String())
+		}
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	const key = "c2VjcmV0a2V5Zm9ybWFueWJ5dGVz+/=="
+	checkPrintConfig(t, "key", []string{"-account", "acct"}, map[string]string{"COSMOS_AUTH_KEY": key}, key, []string{
+		"account  acct  flag -account",
+		"key  (redacted)  COSMOS_AUTH_KEY",
+		"database  (not set)  default",
+	})
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"example/cosmos/fakecosmos"
+)
+
+// The conformance tests check the store's semantics against the in-process
+// fake, or against a real account when COSMOS_ACCOUNT or COSMOS_ENDPOINT is
+// set, together with COSMOS_AUTH_KEY, COSMOS_DATABASE and COSMOS_CONTAINER. The container must be
+// partitioned on /store_id; the TTL test also needs time to live enabled on
+// it. Every test works in a store of its own and deletes it afterwards, so
+// running against a shared container is safe.
+
+// conformanceTarget is the container a conformance test runs against.
+type conformanceTarget struct {
+	client *azcosmos.ContainerClient
+	// ttl is set if the container has time to live enabled.
+	ttl bool
+	// wait lets d pass. Against the fake it advances the fake's clock
+	// instead of sleeping.
+	wait func(d time.Duration)
+}
+
+func newConformanceTarget(t *testing.T) *conformanceTarget {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if endpoint := os.Getenv("COSMOS_ENDPOINT"); endpoint != "" {
+		return realConformanceTarget(ctx, t, endpoint)
+	}
+	if account := os.Getenv("COSMOS_ACCOUNT"); account != "" {
+		return realConformanceTarget(ctx, t, fmt.Sprintf("https://%s.documents.azure.com:443/", account))
+	}
+
+	var offset atomic.Int64
+	srv := fakecosmos.NewServer(&fakecosmos.Options{
+		Now: func() time.Time { return time.Now().Add(time.Duration(offset.Load())) },
+	})
+	t.Cleanup(srv.Close)
+	client, err := srv.Client(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateDatabase(ctx, azcosmos.DatabaseProperties{ID: "conformance"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	db, err := client.NewDatabase("conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -1 enables time to live without expiring items that have no ttl.
+	ttl := int32(-1)
+	_, err = db.CreateContainer(ctx, azcosmos.ContainerProperties{
+		ID:                     "items",
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/store_id"}},
+		DefaultTimeToLive:      &ttl,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, err := db.NewContainer("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &conformanceTarget{
+		client: container,
+		ttl:    true,
+		wait:   func(d time.Duration) { offset.Add(int64(d)) },
+	}
+}
+
+func realConformanceTarget(ctx context.Context, t *testing.T, endpoint string) *conformanceTarget {
+	t.Helper()
+	key, databaseName, containerName := os.Getenv("COSMOS_AUTH_KEY"), os.Getenv("COSMOS_DATABASE"), os.Getenv("COSMOS_CONTAINER")
+	if key == "" || databaseName == "" || containerName == "" {
+		t.Fatal("COSMOS_ACCOUNT or COSMOS_ENDPOINT is set, so COSMOS_AUTH_KEY, COSMOS_DATABASE and COSMOS_CONTAINER must be too")
+	}
+	cred, err := azcosmos.NewKeyCredential(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := azcosmos.NewClientWithKey(endpoint, cred, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, err := client.NewContainer(databaseName, containerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props, err := container.Read(ctx, nil)
+	if err != nil {
+		t.Fatalf("read container %s: %v", containerName, err)
+	}
+	return &conformanceTarget{
+		client: container,
+		ttl:    props.ContainerProperties.DefaultTimeToLive != nil,
+		wait:   time.Sleep,
+	}
+}
+
+// newStore returns an empty store of its own, deleted when the test ends.
+func (target *conformanceTarget) newStore(t *testing.T) *KeyValueStore {
+	t.Helper()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	store := NewKeyValueStore(target.client, fmt.Sprintf("conformance/%s-%s", t.Name(), hex.EncodeToString(suffix)))
+	t.Cleanup(func() {
+		if err := teardownFixtures(context.Background(), store, 8, 30*time.Second); err != nil {
+			t.Errorf("delete store %s: %v", store.StoreID(), err)
+		}
+	})
+	return store
+}
+
+func conformanceContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestConformanceNotFound(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	store := target.newStore(t)
+
+	if value, found, err := store.Get(ctx, "missing"); err != nil || found || value != nil {
+		t.Errorf("Get(missing) = %q, %v, %v; want nil, false, nil", value, found, err)
+	}
+	if found, err := store.Exists(ctx, "missing"); err != nil || found {
+		t.Errorf("Exists(missing) = %v, %v; want false, nil", found, err)
+	}
+	if err := store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete(missing) = %v, want nil", err)
+	}
+	if _, err := target.client.ReadItem(ctx, store.pk, "missing", nil); statusCode(err) != http.StatusNotFound {
+		t.Errorf("ReadItem(missing) error = %v, want 404", err)
+	}
+	if keys, err := store.GetKeys(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("GetKeys() of an empty store = %q, %v; want none", keys, err)
+	}
+	// The get command fails on a missing key, naming it, and exists prints
+	// false.
+	out, _, err := runCommand(ctx, t, store, "get", "missing")
+	if want := "key missing does not exist in store " + store.StoreID(); err == nil || err.Error() != want || out != "" {
+		t.Errorf("get missing printed %q, %v; want nothing and %q", out, err, want)
+	}
+	if out, _, err := runCommand(ctx, t, store, "exists", "missing"); err != nil || out != "false\n" {
+		t.Errorf("exists missing printed %q, %v; want false", out, err)
+	}
+	// A query for a missing id, run as the query command, prints no results
+	// rather than failing.
+	query := "SELECT * FROM c WHERE c.id = @id AND c.store_id = @store_id"
+	storeParam := fmt.Sprintf("@store_id=%q", store.StoreID())
+	out, _, err = runCommand(ctx, t, store, "query", query, "-param", "@id=missing", "-param", storeParam)
+	if err != nil || out != "[]\n" {
+		t.Errorf("query for a missing id printed %q, %v; want []", out, err)
+	}
+	o := azcosmos.QueryOptions{QueryParameters: []azcosmos.QueryParameter{{Name: "@id", Value: "missing"}, {Name: "@store_id", Value: store.StoreID()}}}
+	var n int
+	for _, err := range QueryItems[Document](ctx, target.client, query, store.pk, &o) {
+		if err != nil {
+			t.Fatalf("QueryItems for a missing id: %v", err)
+		}
+		n++
+	}
+	if n != 0 {
+		t.Errorf("QueryItems for a missing id yielded %d items, want 0", n)
+	}
+}
+
+func TestConformancePointRead(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	store := target.newStore(t)
+
+	if err := store.Set(ctx, "k", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := store.Get(ctx, "k"); err != nil || !found || string(value) != "v1" {
+		t.Errorf("Get(k) = %q, %v, %v; want v1, true, nil", value, found, err)
+	}
+	if found, err := store.Exists(ctx, "k"); err != nil || !found {
+		t.Errorf("Exists(k) = %v, %v; want true, nil", found, err)
+	}
+
+	resp, err := target.client.ReadItem(ctx, store.pk, "k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(resp.Value, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.ID != "k" || doc.StoreID != store.StoreID() || string(doc.Value) != "v1" {
+		t.Errorf("read item = %+v, want id k, store_id %s and value v1", doc, store.StoreID())
+	}
+	if doc.Rid == "" || doc.Self == "" || doc.Timestamp == 0 {
+		t.Errorf("read item lacks system properties: %+v", doc)
+	}
+	if resp.ETag == "" || string(resp.ETag) != doc.Etag {
+		t.Errorf("ETag header %q does not match _etag %q", resp.ETag, doc.Etag)
+	}
+
+	// A write changes the etag, and a read returns the new one.
+	if err := store.Set(ctx, "k", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	again, err := target.client.ReadItem(ctx, store.pk, "k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ETag == resp.ETag {
+		t.Errorf("etag %s did not change when the item was replaced", resp.ETag)
+	}
+	if value, _, err := store.Get(ctx, "k"); err != nil || string(value) != "v2" {
+		t.Errorf("Get(k) after replacing it = %q, %v; want v2, nil", value, err)
+	}
+}
+
+func TestConformanceETagConflicts(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	store := target.newStore(t)
+	item := func(value string) []byte {
+		b, _ := json.Marshal(Pair{ID: "k", Value: []byte(value), StoreID: store.StoreID()})
+		return b
+	}
+
+	created, err := target.client.CreateItem(ctx, store.pk, item("v1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.client.CreateItem(ctx, store.pk, item("v1"), nil); statusCode(err) != http.StatusConflict {
+		t.Errorf("creating an existing item: error = %v, want 409", err)
+	}
+	replaced, err := target.client.ReplaceItem(ctx, store.pk, "k", item("v2"), &azcosmos.ItemOptions{IfMatchEtag: &created.ETag})
+	if err != nil {
+		t.Fatalf("replace with the current etag: %v", err)
+	}
+	if replaced.ETag == created.ETag {
+		t.Errorf("replace kept etag %s", created.ETag)
+	}
+	stale := &azcosmos.ItemOptions{IfMatchEtag: &created.ETag}
+	if _, err := target.client.ReplaceItem(ctx, store.pk, "k", item("v3"), stale); statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("replace with a stale etag: error = %v, want 412", err)
+	}
+	if _, err := target.client.UpsertItem(ctx, store.pk, item("v3"), stale); statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("upsert with a stale etag: error = %v, want 412", err)
+	}
+	if _, err := target.client.DeleteItem(ctx, store.pk, "k", stale); statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("delete with a stale etag: error = %v, want 412", err)
+	}
+	if value, _, err := store.Get(ctx, "k"); err != nil || string(value) != "v2" {
+		t.Errorf("Get(k) = %q, %v; want v2, nil", value, err)
+	}
+}
+
+func TestConformancePaging(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	store := target.newStore(t)
+	space := KeySpace{Size: 25, Seed: 1}
+	if err := seedFixtures(ctx, store, space, 16, 8, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFixtures(ctx, store, space, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	query := "SELECT c.id FROM c WHERE c.store_id = @store_id"
+	o := azcosmos.QueryOptions{
+		QueryParameters: []azcosmos.QueryParameter{{Name: "@store_id", Value: store.StoreID()}},
+		PageSizeHint:    10,
+	}
+	pager := target.client.NewQueryItemsPager(query, store.pk, &o)
+	first, err := pager.NextPage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Items) > 10 || first.ContinuationToken == nil {
+		t.Fatalf("first page has %d items and continuation %v; want at most 10 and a continuation", len(first.Items), first.ContinuationToken)
+	}
+
+	// Resuming from the continuation yields the rest, each key once.
+	o.ContinuationToken = first.ContinuationToken
+	keys := idsOf(t, first.Items)
+	pages := 1
+	for page, err := range pagesOf(ctx, target.client.NewQueryItemsPager(query, store.pk, &o)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) > 10 {
+			t.Errorf("page %d has %d items, want at most 10", pages, len(page))
+		}
+		keys = append(keys, idsOf(t, page)...)
+		pages++
+	}
+	slices.Sort(keys)
+	want := space.Keys()
+	slices.Sort(want)
+	if !slices.Equal(keys, want) {
+		t.Errorf("paged keys = %q, want %q", keys, want)
+	}
+	if pages < 3 {
+		t.Errorf("25 keys came in %d pages of at most 10", pages)
+	}
+}
+
+// pagesOf yields the items of each remaining page of pager.
+func pagesOf(ctx context.Context, pager *runtime.Pager[azcosmos.QueryItemsResponse]) iter.Seq2[[][]byte, error] {
+	return func(yield func([][]byte, error) bool) {
+		for pager.More() {
+			resp, err := pager.NextPage(ctx)
+			if !yield(resp.Items, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func idsOf(t *testing.T, items [][]byte) []string {
+	t.Helper()
+	ids := make([]string, len(items))
+	for i, item := range items {
+		var doc struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &doc); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = doc.ID
+	}
+	return ids
+}
+
+func TestConformanceBatchAtomicity(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	store := target.newStore(t)
+	item := func(key, value string) []byte {
+		b, _ := json.Marshal(Pair{ID: key, Value: []byte(value), StoreID: store.StoreID()})
+		return b
+	}
+	if err := store.Set(ctx, "a", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conflicting create fails the batch, so neither earlier write
+	// applies.
+	batch := target.client.NewTransactionalBatch(store.pk)
+	batch.CreateItem(item("b", "v1"), nil)
+	batch.UpsertItem(item("a", "v2"), nil)
+	batch.CreateItem(item("a", "v3"), nil)
+	resp, err := target.client.ExecuteTransactionalBatch(ctx, batch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success {
+		t.Fatal("batch with a conflicting create succeeded")
+	}
+	var statuses []int32
+	for _, r := range resp.OperationResults {
+		statuses = append(statuses, r.StatusCode)
+	}
+	if want := []int32{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusConflict}; !slices.Equal(statuses, want) {
+		t.Errorf("operation statuses = %v, want %v", statuses, want)
+	}
+	if found, err := store.Exists(ctx, "b"); err != nil || found {
+		t.Errorf("Exists(b) after a failed batch = %v, %v; want false, nil", found, err)
+	}
+	if value, _, err := store.Get(ctx, "a"); err != nil || string(value) != "v1" {
+		t.Errorf("Get(a) after a failed batch = %q, %v; want v1, nil", value, err)
+	}
+
+	// Operations see the writes of earlier ones.
+	batch = target.client.NewTransactionalBatch(store.pk)
+	batch.CreateItem(item("b", "v1"), nil)
+	batch.ReadItem("b", nil)
+	batch.DeleteItem("a", nil)
+	resp, err = target.client.ExecuteTransactionalBatch(ctx, batch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success {
+		t.Fatalf("batch failed: %+v", resp.OperationResults)
+	}
+	if keys, err := store.GetKeys(ctx); err != nil || !slices.Equal(keys, []string{"b"}) {
+		t.Errorf("GetKeys() = %q, %v; want [b]", keys, err)
+	}
+}
+
+func TestConformanceTTL(t *testing.T) {
+	ctx := conformanceContext(t)
+	target := newConformanceTarget(t)
+	if !target.ttl {
+		t.Skip("time to live is not enabled on the container")
+	}
+	store := target.newStore(t)
+	write := func(key string, ttl int) {
+		t.Helper()
+		item, _ := json.Marshal(map[string]any{"id": key, "value": []byte("v"), "store_id": store.StoreID(), "ttl": ttl})
+		if _, err := target.client.UpsertItem(ctx, store.pk, item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("short", 1)
+	write("forever", -1)
+	if found, err := store.Exists(ctx, "short"); err != nil || !found {
+		t.Fatalf("Exists(short) before it expires = %v, %v; want true, nil", found, err)
+	}
+
+	target.wait(3 * time.Second)
+	if found, err := store.Exists(ctx, "short"); err != nil || found {
+		t.Errorf("Exists(short) after it expired = %v, %v; want false, nil", found, err)
+	}
+	if keys, err := store.GetKeys(ctx); err != nil || !slices.Equal(keys, []string{"forever"}) {
+		t.Errorf("GetKeys() = %q, %v; want [forever]", keys, err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// connection holds the settings shared by every command.
+type connection struct {
+	account    string
+	key        string
+	database   string
+	container  string
+	store      string
+	opTimeout  time.Duration
+	runTimeout time.Duration
+
+	// connectionString, if set, gives the endpoint and key instead of
+	// account and key. endpoint, if set, replaces that of the account.
+	connectionString   string
+	endpoint           string
+	emulator           bool
+	caFile             string
+	insecureSkipVerify bool
+
+	configPath string
+	resolved   []resolvedSetting
+}
+
+// registerFlags registers the connection flags. Settings not given as flags
+// are resolved from the environment and the config file by resolve.
+func (c *connection) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.configPath, "config", "", "read settings not given as flags or COSMOS_* variables from the JSON `file` (COSMOS_CONFIG)")
+	fs.StringVar(&c.connectionString, "connection-string", "", "connect with the account `connection string` AccountEndpoint=...;AccountKey=...; instead of -account and -key; prefer COSMOS_CONNECTION_STRING, which is not visible to other processes")
+	fs.BoolVar(&c.emulator, "emulator", false, "connect to the Cosmos DB emulator, at "+emulatorEndpoint+" with its well-known key unless -endpoint or -key say otherwise (COSMOS_EMULATOR)")
+	fs.StringVar(&c.endpoint, "endpoint", "", "connect to the account at `URL` rather than that of -account, for example a sovereign cloud or a local fake (COSMOS_ENDPOINT)")
+	fs.StringVar(&c.account, "account", "", "Cosmos DB account `name` (COSMOS_ACCOUNT)")
+	fs.StringVar(&c.key, "key", "", "account `key`; prefer COSMOS_AUTH_KEY, which is not visible to other processes")
+	fs.StringVar(&c.caFile, "ca-file", "", "also trust the PEM CA certificates in `file`, such as the emulator's (COSMOS_CA_FILE)")
+	fs.BoolVar(&c.insecureSkipVerify, "insecure-skip-verify", false, "do not verify the server's TLS certificate; only for local testing (COSMOS_INSECURE_SKIP_VERIFY)")
+	fs.StringVar(&c.database, "database", "", "database `name` (COSMOS_DATABASE)")
+	fs.StringVar(&c.container, "container", "", "container `name` (COSMOS_CONTAINER)")
+	fs.StringVar(&c.store, "store", "cosmos/default", "store `id`, the partition key of its items (COSMOS_PARTITION_KEY_STRING)")
+	fs.DurationVar(&c.opTimeout, "timeout", 30*time.Second, "bound each request by `duration`; 0 disables it (COSMOS_OP_TIMEOUT)")
+	fs.DurationVar(&c.runTimeout, "run-timeout", 0, "bound the whole run by `duration`; 0 disables it (COSMOS_RUN_TIMEOUT)")
+}
+
+// session is what a command runs with: clients for the account and the
+// container, and the store.
+type session struct {
+	client    *azcosmos.Client
+	container *azcosmos.ContainerClient
+	store     *KeyValueStore
+	conn      *connection
+	// charges adds up the request charge of every response.
+	charges *chargeMeter
+	// out receives the output of a command, and errOut its progress and
+	// diagnostics.
+	out, errOut io.Writer
+}
+
+// open connects to the account. The returned function releases the
+// transport, closing a cassette being recorded.
+func (c *connection) open() (*session, func(), error) {
+	endpoint, key := c.endpoint, c.key
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.documents.azure.com:443/", c.account)
+	}
+	if c.connectionString != "" {
+		creds, err := parseConnectionString(c.connectionString)
+		if err != nil {
+			return nil, nil, err
+		}
+		endpoint, key = creds.endpoint, creds.key
+	}
+	cred, err := azcosmos.NewKeyCredential(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create credential: %w", err)
+	}
+	httpClient, err := c.httpClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	clientOptions, finishTransport, err := clientOptionsFromEnv(httpClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("set up transport: %w", err)
+	}
+	if clientOptions == nil {
+		clientOptions = &azcosmos.ClientOptions{}
+	}
+	charges := &chargeMeter{}
+	clientOptions.PerRetryPolicies = append(clientOptions.PerRetryPolicies, charges)
+	client, err := azcosmos.NewClientWithKey(endpoint, cred, clientOptions)
+	if err != nil {
+		finishTransport()
+		return nil, nil, fmt.Errorf("create client: %w", err)
+	}
+	container, err := client.NewContainer(c.database, c.container)
+	if err != nil {
+		finishTransport()
+		return nil, nil, fmt.Errorf("create container client: %w", err)
+	}
+	s := &session{
+		client:    client,
+		container: container,
+		store:     NewKeyValueStore(container, c.store),
+		conn:      c,
+		charges:   charges,
+		out:       os.Stdout,
+		errOut:    os.Stderr,
+	}
+	return s, finishTransport, nil
+}
+
+// httpClient returns the client to send requests with, which trusts the
+// certificates of the CA file, or skips verification, if asked to.
+func (c *connection) httpClient() (*http.Client, error) {
+	if c.caFile == "" && !c.insecureSkipVerify {
+		return http.DefaultClient, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.insecureSkipVerify}
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s holds no PEM certificates", c.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// clientOptionsFromEnv returns client options that send requests with
+// client, recording every interaction to the cassette at COSMOS_RECORD, or
+// replay them from the cassette at COSMOS_REPLAY instead of using the
+// network. COSMOS_FAULTS injects latency and failures in front of either. The
+// returned function reports injected faults and closes the cassette.
+func clientOptionsFromEnv(client *http.Client) (*azcosmos.ClientOptions, func(), error) {
+	var transport policy.Transporter = client
+	finish := func() {}
+
+	record, replay := os.Getenv("COSMOS_RECORD"), os.Getenv("COSMOS_REPLAY")
+	switch {
+	case record != "" && replay != "":
+		return nil, finish, fmt.Errorf("COSMOS_RECORD and COSMOS_REPLAY are mutually exclusive")
+	case record != "":
+		t, err := NewRecordingTransport(record, client)
+		if err != nil {
+			return nil, finish, err
+		}
+		transport, finish = t, func() { t.Close() }
+	case replay != "":
+		t, err := NewReplayTransport(replay)
+		if err != nil {
+			return nil, finish, err
+		}
+		transport = t
+	}
+
+	if spec := os.Getenv("COSMOS_FAULTS"); spec != "" {
+		cfg, err := ParseFaultConfig(spec)
+		if err != nil {
+			return nil, finish, err
+		}
+		t := NewFaultTransport(transporterRoundTripper{transport}, cfg)
+		transport = t
+		closeNext := finish
+		finish = func() {
+			log.Printf("Injected faults: %v", t.Injected())
+			closeNext()
+		}
+	}
+
+	if transport == policy.Transporter(http.DefaultClient) {
+		return nil, finish, nil
+	}
+	return &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}}, finish, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example/cosmos/fakecosmos"
+)
+
+func TestResolveEmulator(t *testing.T) {
+	tests := []struct {
+		name                        string
+		args                        []string
+		env                         map[string]string
+		wantEndpoint, wantKey       string
+		wantEndpointSrc, wantKeySrc string
+	}{
+		{"defaults", []string{"-emulator"}, nil, emulatorEndpoint, emulatorKey, "emulator", "emulator"},
+		{"from env", nil, map[string]string{"COSMOS_EMULATOR": "true"}, emulatorEndpoint, emulatorKey, "emulator", "emulator"},
+		{"endpoint given", []string{"-emulator", "-endpoint", "https://emulator:8081/"}, nil, "https://emulator:8081/", emulatorKey, "flag -endpoint", "emulator"},
+		{"key given", []string{"-emulator"}, map[string]string{"COSMOS_AUTH_KEY": "a2V5"}, emulatorEndpoint, "a2V5", "emulator", "COSMOS_AUTH_KEY"},
+		{"not in emulator mode", nil, nil, "", "", "default", "default"},
+		// A connection string gives the endpoint and key itself.
+		{"with a connection string", []string{"-emulator", "-connection-string", "AccountEndpoint=https://acct.documents.azure.com:443/;AccountKey=a2V5"}, nil, "", "", "default", "default"},
+	}
+	for _, tt := range tests {
+		conn, err := resolveConnection(t, tt.args, tt.env, "")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		endpoint, endpointSrc := conn.sourceOf("endpoint")
+		key, keySrc := conn.sourceOf("key")
+		if endpoint != tt.wantEndpoint || endpointSrc != tt.wantEndpointSrc {
+			t.Errorf("%s: endpoint = %q from %q, want %q from %q", tt.name, endpoint, endpointSrc, tt.wantEndpoint, tt.wantEndpointSrc)
+		}
+		if key != tt.wantKey || keySrc != tt.wantKeySrc {
+			t.Errorf("%s: key = %q from %q, want %q from %q", tt.name, key, keySrc, tt.wantKey, tt.wantKeySrc)
+		}
+	}
+}
+
+// writeCAFile writes the certificate of srv to a PEM file and returns its
+// path.
+func writeCAFile(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHTTPClient(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// Keep the failed handshake of the untrusted client out of the log.
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	badPEM := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(badPEM, []byte("not a certificate\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		conn connection
+		// wantErr is part of the error of httpClient, if it fails;
+		// wantGetErr that of a request to the server.
+		wantErr, wantGetErr string
+	}{
+		{name: "system roots", wantGetErr: "certificate signed by unknown authority"},
+		{name: "ca file", conn: connection{caFile: writeCAFile(t, srv)}},
+		{name: "insecure skip verify", conn: connection{insecureSkipVerify: true}},
+		{name: "bad ca file", conn: connection{caFile: badPEM}, wantErr: "holds no PEM certificates"},
+		{name: "missing ca file", conn: connection{caFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: "read CA file"},
+	}
+	for _, tt := range tests {
+		client, err := tt.conn.httpClient()
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: httpClient() error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: httpClient(): %v", tt.name, err)
+			continue
+		}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		switch {
+		case tt.wantGetErr == "" && err != nil:
+			t.Errorf("%s: GET: %v", tt.name, err)
+		case tt.wantGetErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantGetErr)):
+			t.Errorf("%s: GET error = %v, want one containing %q", tt.name, err, tt.wantGetErr)
+		}
+	}
+}
+
+// TestOpenOverTLS connects as -emulator does to a fake served over TLS,
+// trusting its certificate through -ca-file.
+func TestOpenOverTLS(t *testing.T) {
+	a := fakecosmos.NewAccount(nil)
+	if err := a.CreateContainer("db", "items", "/store_id"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewTLSServer(a)
+	t.Cleanup(srv.Close)
+	for _, env := range []string{"COSMOS_RECORD", "COSMOS_REPLAY", "COSMOS_FAULTS"} {
+		t.Setenv(env, "")
+	}
+
+	conn, err := resolveConnection(t, []string{"-emulator", "-endpoint", srv.URL, "-ca-file", writeCAFile(t, srv), "-database", "db", "-container", "items"}, nil, "")
+	if err == nil {
+		err = conn.validate()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, finish, err := conn.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer finish()
+	ctx := testContext(t)
+	if err := s.store.Set(ctx, "k", []byte("v")); err != nil {
+		t.Fatalf("Set over TLS: %v", err)
+	}
+	if value, found, err := s.store.Get(ctx, "k"); err != nil || !found || string(value) != "v" {
+		t.Errorf("Get over TLS = %q, %v, %v; want v", value, found, err)
+	}
+}
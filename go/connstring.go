@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// accountCredentials are the endpoint and key of an account, as given by a
+// connection string.
+type accountCredentials struct {
+	endpoint string
+	key      string
+}
+
+// parseConnectionString parses an account connection string of the form
+// AccountEndpoint=https://account.documents.azure.com:443/;AccountKey=...;
+// Names are case-insensitive, spaces around names, values and semicolons are
+// ignored, and so are settings other than the endpoint and key. Errors never
+// include the key.
+func parseConnectionString(s string) (accountCredentials, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	settings := map[string]string{}
+	for i, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		// Base64 keys end in =, so only the first = separates the name.
+		name, value, ok := strings.Cut(part, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return accountCredentials{}, fmt.Errorf("connection string: part %d is not of the form Name=Value", i+1)
+		}
+		lower := strings.ToLower(name)
+		if _, dup := settings[lower]; dup {
+			return accountCredentials{}, fmt.Errorf("connection string: %s is given more than once", name)
+		}
+		settings[lower] = value
+	}
+
+	creds := accountCredentials{endpoint: settings["accountendpoint"], key: settings["accountkey"]}
+	var errs []error
+	if creds.endpoint == "" {
+		errs = append(errs, errors.New("connection string: AccountEndpoint is missing"))
+	} else if err := checkEndpoint(creds.endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("connection string: AccountEndpoint %w", err))
+	}
+	if creds.key == "" {
+		errs = append(errs, errors.New("connection string: AccountKey is missing"))
+	} else if _, err := base64.StdEncoding.DecodeString(creds.key); err != nil {
+		errs = append(errs, errors.New("connection string: AccountKey is not valid base64"))
+	}
+	return creds, errors.Join(errs...)
+}
+
+// checkEndpoint checks that endpoint is an absolute http or https URL.
+func checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", endpoint)
+	}
+	return nil
+}
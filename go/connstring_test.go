@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	const endpoint, key = "https://acct.documents.azure.com:443/", "c2VjcmV0a2V5Zm9ybWFueWJ5dGVz+/=="
+	for _, s := range []string{
+		"AccountEndpoint=" + endpoint + ";AccountKey=" + key + ";",
+		"AccountEndpoint=" + endpoint + ";AccountKey=" + key,
+		" accountendpoint = " + endpoint + " ; ACCOUNTKEY=" + key + " ;; ",
+		`"AccountKey=` + key + `;AccountEndpoint=` + endpoint + `;Database=mydb;"`,
+	} {
+		got, err := parseConnectionString(s)
+		if err != nil || got.endpoint != endpoint || got.key != key {
+			t.Errorf("parseConnectionString(%q) = %+v, %v; want %s and the key", s, got, err, endpoint)
+		}
+	}
+
+	for _, tc := range []struct{ s, want string }{
+		{"", "AccountEndpoint is missing"},
+		{"AccountKey=" + key, "AccountEndpoint is missing"},
+		{"AccountEndpoint=" + endpoint, "AccountKey is missing"},
+		{"AccountEndpoint=" + endpoint + ";" + key, "AccountKey is missing"},
+		{"AccountEndpoint=" + endpoint + ";AccountKey;" + key, "part 2 is not of the form Name=Value"},
+		{"AccountEndpoint=" + endpoint + ";=x;AccountKey=" + key, "part 2 is not of the form Name=Value"},
+		{"AccountEndpoint=acct.documents.azure.com;AccountKey=" + key, "is not an http or https URL"},
+		{"AccountEndpoint=ftp://acct/;AccountKey=" + key, "is not an http or https URL"},
+		{"AccountEndpoint=" + endpoint + ";AccountKey=not base64!", "AccountKey is not valid base64"},
+		{"AccountEndpoint=" + endpoint + ";AccountKey=" + key + ";accountkey=" + key, "accountkey is given more than once"},
+	} {
+		_, err := parseConnectionString(tc.s)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseConnectionString(%q) error = %v, want one containing %q", tc.s, err, tc.want)
+		}
+		if err != nil && strings.Contains(err.Error(), key) {
+			t.Errorf("parseConnectionString(%q) error %q includes the key", tc.s, err)
+		}
+	}
+}
+
+func TestPrintConfigRedactsConnectionString(t *testing.T) {
+	const key = "c2VjcmV0a2V5Zm9ybWFueWJ5dGVz+/=="
+	// The endpoint of a connection string is shown, but not its key.
+	checkPrintConfig(t, "connection string", nil, map[string]string{"COSMOS_CONNECTION_STRING": "AccountEndpoint=https://acct.documents.azure.com:443/;AccountKey=" + key}, key, []string{
+		"connection-string  AccountEndpoint=https://acct.documents.azure.com:443/;AccountKey=(redacted)  COSMOS_CONNECTION_STRING",
+	})
+	// One that does not parse is redacted whole.
+	checkPrintConfig(t, "malformed connection string", []string{"-connection-string", "AccountKey=" + key}, nil, key, []string{
+		"connection-string  (redacted)  flag -connection-string",
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Value decoding strategies selectable with COSMOS_DECODE.
+const (
+	DecodeJSON = "json"
+	DecodeLazy = "lazy"
+)
+
+// valueDecoder extracts the value of a stored item.
+type valueDecoder func(item []byte) ([]byte, error)
+
+var valueDecoders = map[string]valueDecoder{
+	DecodeJSON: decodeValueJSON,
+	DecodeLazy: decodeValueLazy,
+}
+
+// decodeValueJSON unmarshals the whole item into a Document.
+func decodeValueJSON(item []byte) ([]byte, error) {
+	doc := Document{}
+	if err := json.Unmarshal(item, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Value, nil
+}
+
+// decodeValueLazy decodes only the value of the item.
+func decodeValueLazy(item []byte) ([]byte, error) {
+	doc := LazyDocument{}
+	if err := doc.Decode(item); err != nil {
+		return nil, err
+	}
+	return doc.Value()
+}
+
+// Document is a stored item as Cosmos DB returns it, system properties
+// included.
+type Document struct {
+	ID          string `json:"id"`
+	Value       []byte `json:"value"`
+	StoreID     string `json:"store_id"`
+	Rid         string `json:"_rid"`
+	Self        string `json:"_self"`
+	Etag        string `json:"_etag"`
+	Attachments string `json:"_attachments"`
+	Timestamp   int64  `json:"_ts"`
+}
+
+// LazyDocument is a low-allocation alternative to Document. Decode keeps the
+// base64 value as a slice of the input and skips the system fields; the value
+// is only decoded when Value is called.
+//
+// The raw value aliases the input passed to Decode, which must not be
+// modified while the document is in use.
+type LazyDocument struct {
+	ID      string
+	StoreID string
+
+	rawValue []byte
+	value    []byte
+	decoded  bool
+}
+
+// RawValue returns the still base64 encoded value.
+func (d *LazyDocument) RawValue() []byte {
+	return d.rawValue
+}
+
+// Value decodes and returns the value. The result is cached.
+func (d *LazyDocument) Value() ([]byte, error) {
+	if d.decoded || d.rawValue == nil {
+		return d.value, nil
+	}
+	value := make([]byte, base64.StdEncoding.DecodedLen(len(d.rawValue)))
+	n, err := base64.StdEncoding.Decode(value, d.rawValue)
+	if err != nil {
+		return nil, fmt.Errorf("decode value: %w", err)
+	}
+	d.value, d.decoded = value[:n], true
+	return d.value, nil
+}
+
+var errSyntax = errors.New("invalid document JSON")
+
+// Decode parses a JSON object into d, ignoring every field other than id,
+// store_id and value. Ignored fields are only checked for balanced nesting.
+func (d *LazyDocument) Decode(data []byte) error {
+	*d = LazyDocument{}
+	s := scanner{data: data}
+	s.skipSpace()
+	if !s.consume('{') {
+		return errSyntax
+	}
+	s.skipSpace()
+	if s.consume('}') {
+		return s.end()
+	}
+	for {
+		s.skipSpace()
+		key, escaped, ok := s.stringToken()
+		if !ok {
+			return errSyntax
+		}
+		s.skipSpace()
+		if !s.consume(':') {
+			return errSyntax
+		}
+		s.skipSpace()
+
+		var err error
+		switch {
+		case escaped:
+			// Field names we care about never need escaping.
+			err = s.skipValue()
+		case string(key) == "id":
+			d.ID, err = s.stringValue()
+		case string(key) == "store_id":
+			d.StoreID, err = s.stringValue()
+		case string(key) == "value":
+			d.rawValue, err = s.rawValue()
+		default:
+			err = s.skipValue()
+		}
+		if err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		if s.consume('}') {
+			return s.end()
+		}
+		if !s.consume(',') {
+			return errSyntax
+		}
+	}
+}
+
+// scanner is a minimal JSON tokenizer over a byte slice.
+type scanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) consume(c byte) bool {
+	if s.pos < len(s.data) && s.data[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *scanner) end() error {
+	s.skipSpace()
+	if s.pos != len(s.data) {
+		return errSyntax
+	}
+	return nil
+}
+
+// stringToken returns the contents of the string at the current position,
+// without quotes and still escaped.
+func (s *scanner) stringToken() (contents []byte, escaped, ok bool) {
+	if !s.consume('"') {
+		return nil, false, false
+	}
+	start := s.pos
+	for s.pos < len(s.data) {
+		end := bytes.IndexByte(s.data[s.pos:], '"')
+		if end < 0 {
+			break
+		}
+		if esc := bytes.IndexByte(s.data[s.pos:s.pos+end], '\\'); esc >= 0 {
+			// Skip the escaped character, which may be a quote.
+			escaped = true
+			s.pos += esc + 2
+			continue
+		}
+		contents = s.data[start : s.pos+end]
+		s.pos += end + 1
+		return contents, escaped, true
+	}
+	return nil, false, false
+}
+
+// stringValue returns the string at the current position, unescaping it if
+// needed. null yields the empty string, as with encoding/json.
+func (s *scanner) stringValue() (string, error) {
+	if s.literal("null") {
+		return "", nil
+	}
+	start := s.pos
+	contents, escaped, ok := s.stringToken()
+	if !ok {
+		return "", errSyntax
+	}
+	if !escaped {
+		return string(contents), nil
+	}
+	var v string
+	if err := json.Unmarshal(s.data[start:s.pos], &v); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// rawValue returns the base64 string at the current position without copying
+// it. An escaped string, which a JSON encoder may produce for '/', is
+// unescaped into a copy.
+func (s *scanner) rawValue() ([]byte, error) {
+	if s.literal("null") {
+		return nil, nil
+	}
+	start := s.pos
+	contents, escaped, ok := s.stringToken()
+	if !ok {
+		return nil, errSyntax
+	}
+	if !escaped {
+		return contents, nil
+	}
+	var v string
+	if err := json.Unmarshal(s.data[start:s.pos], &v); err != nil {
+		return nil, err
+	}
+	return []byte(v), nil
+}
+
+func (s *scanner) literal(lit string) bool {
+	if len(s.data)-s.pos >= len(lit) && string(s.data[s.pos:s.pos+len(lit)]) == lit {
+		s.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// skipValue moves past the value at the current position.
+func (s *scanner) skipValue() error {
+	if s.pos >= len(s.data) {
+		return errSyntax
+	}
+	switch c := s.data[s.pos]; {
+	case c == '"':
+		if _, _, ok := s.stringToken(); !ok {
+			return errSyntax
+		}
+	case c == '{' || c == '[':
+		depth := 0
+		for s.pos < len(s.data) {
+			switch s.data[s.pos] {
+			case '"':
+				if _, _, ok := s.stringToken(); !ok {
+					return errSyntax
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			s.pos++
+			if depth == 0 {
+				return nil
+			}
+		}
+		return errSyntax
+	case c == 't' || c == 'f' || c == 'n':
+		if !s.literal("true") && !s.literal("false") && !s.literal("null") {
+			return errSyntax
+		}
+	default:
+		start := s.pos
+		for s.pos < len(s.data) && strings.IndexByte("+-.0123456789eE", s.data[s.pos]) >= 0 {
+			s.pos++
+		}
+		if s.pos == start {
+			return errSyntax
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// queryResultItem returns an item as Cosmos DB returns it, system fields
+// included, holding a value of size bytes.
+func queryResultItem(tb testing.TB, size int) []byte {
+	tb.Helper()
+	item, err := json.Marshal(map[string]any{
+		"id":           "k0123456789abcdef",
+		"value":        bytes.Repeat([]byte{0xfb, 0xff, 0x01}, size/3+1)[:size],
+		"store_id":     "cosmos/default",
+		"_rid":         "hXUIAJcVXW0BAAAAAAAAAA==",
+		"_self":        "dbs/hXUIAA==/colls/hXUIAJcVXW0=/docs/hXUIAJcVXW0BAAAAAAAAAA==/",
+		"_etag":        `"0a00d7f4-0000-0700-0000-67b6243c0000"`,
+		"_attachments": "attachments/",
+		"_ts":          1739990076,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return item
+}
+
+func TestLazyDocumentMatchesJSON(t *testing.T) {
+	items := [][]byte{
+		queryResultItem(t, 0),
+		queryResultItem(t, 100),
+		[]byte(`{"id":"a\"b","store_id":null,"nested":{"x":[1,{"y":"}"}]},"value":"aGk\/"}`),
+		[]byte(`{"x":-1.5e3,"ok":true,"value":null,"id":"é"}`),
+	}
+	for _, item := range items {
+		want := Document{}
+		if err := json.Unmarshal(item, &want); err != nil {
+			t.Fatalf("json.Unmarshal(%s): %v", item, err)
+		}
+		got := LazyDocument{}
+		if err := got.Decode(item); err != nil {
+			t.Fatalf("Decode(%s): %v", item, err)
+		}
+		value, err := got.Value()
+		if err != nil {
+			t.Fatalf("Value(%s): %v", item, err)
+		}
+		if got.ID != want.ID || got.StoreID != want.StoreID || !bytes.Equal(value, want.Value) {
+			t.Errorf("Decode(%s) = %q, %q, %x; want %q, %q, %x", item, got.ID, got.StoreID, value, want.ID, want.StoreID, want.Value)
+		}
+	}
+
+	for _, item := range []string{``, `[]`, `{"id":}`, `{"id":"a"`, `{"id":"a"} x`, `{"value":"%%%"}`} {
+		doc := LazyDocument{}
+		err := doc.Decode([]byte(item))
+		if err == nil {
+			_, err = doc.Value()
+		}
+		if err == nil {
+			t.Errorf("Decode(%s) succeeded, want error", item)
+		}
+	}
+}
+
+func BenchmarkDecodeDocument(b *testing.B) {
+	for _, size := range []int{16, 1024, 64 * 1024} {
+		item := queryResultItem(b, size)
+		b.Run(fmt.Sprintf("json/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(item)))
+			for range b.N {
+				doc := Document{}
+				if err := json.Unmarshal(item, &doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("lazy/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(item)))
+			for range b.N {
+				doc := LazyDocument{}
+				if err := doc.Decode(item); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := doc.Value(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		// Listing keys never touches the value.
+		b.Run(fmt.Sprintf("lazy-id-only/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(item)))
+			for range b.N {
+				doc := LazyDocument{}
+				if err := doc.Decode(item); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// Package fakecosmos is an in-memory fake of the subset of the Cosmos DB REST
+// API used by this repository. Point an azcosmos client at a Server's URL
+// to run store and query code without a real account:
+//
+//	srv := fakecosmos.NewServer(nil)
+//	defer srv.Close()
+//	srv.Account.CreateContainer("db", "items", "/store_id")
+//	container, _ := srv.ContainerClient("db", "items", nil)
+package fakecosmos
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Key is the account key of the fake. It is the well-known key of the Cosmos
+// DB emulator, so clients configured for the emulator work unchanged.
+const Key = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
+
+// Options configures an Account.
+type Options struct {
+	// Now returns the current time. It defaults to time.Now. Requests must be
+	// signed within 15 minutes of it.
+	Now func() time.Time
+	// Keys are the base64 account keys requests may be signed with. They
+	// default to Key.
+	Keys []string
+	// Throughput is the RU/s provisioned for containers that are not
+	// created with a throughput of their own. Item operations beyond it are
+	// throttled with 429 Too Many Requests. Zero is unlimited.
+	Throughput float64
+	// EmptyPages makes queries and feeds return an empty page, with a
+	// continuation token, before every page of results. The service does
+	// this for cross-partition queries, so clients must keep paging.
+	EmptyPages bool
+}
+
+// Account is the state of a fake Cosmos DB account. It serves the REST API
+// as an http.Handler and is safe for concurrent use. Requests must carry a
+// master key signature made with one of the account's keys.
+type Account struct {
+	now        func() time.Time
+	throughput float64
+	emptyPages bool
+
+	mu        sync.Mutex
+	keys      []string
+	databases map[string]*database
+	nextRID   uint32
+	lsn       int64
+
+	// The log of a file-backed account; see Open.
+	path             string
+	log              *os.File
+	logErr           error
+	logRecords       int
+	compactedRecords int
+}
+
+type database struct {
+	id         string
+	rid        []byte
+	etag       string
+	ts         int64
+	containers map[string]*container
+}
+
+type container struct {
+	id                string
+	rid               []byte
+	etag              string
+	ts                int64
+	partitionKeyPaths []string
+	defaultTTL        *int
+	indexingPolicy    json.RawMessage
+	budget            bucket
+	nextDocRID        uint64
+	// items holds the documents of each logical partition, keyed by the
+	// JSON encoded partition key values and then by id.
+	items map[string]map[string]*item
+	// changes is the change log of the container's one partition key range,
+	// in LSN order. Entries superseded by a later write or a delete are
+	// pruned once they make up half of it.
+	changes    []change
+	superseded int
+	// nextExpiry is the Unix time before which no item expires. Zero
+	// makes the next item request look for expired items.
+	nextExpiry int64
+}
+
+// change is an entry in a container's change log.
+type change struct {
+	lsn    int64
+	pk, id string
+}
+
+// setItem stores it in the logical partition pk and logs the change.
+func (c *container) setItem(pk string, it *item) {
+	id := it.body["id"].(string)
+	if c.items[pk] == nil {
+		c.items[pk] = map[string]*item{}
+	}
+	if c.items[pk][id] != nil {
+		c.superseded++
+	}
+	c.items[pk][id] = it
+	if exp, ok := c.expiry(it); ok {
+		c.nextExpiry = min(c.nextExpiry, exp)
+	}
+	c.changes = append(c.changes, change{lsn: it.lsn, pk: pk, id: id})
+	c.pruneChanges()
+}
+
+// deleteItem removes an item, and its logical partition if it is left empty.
+func (c *container) deleteItem(pk, id string) {
+	if c.items[pk][id] != nil {
+		c.superseded++
+	}
+	delete(c.items[pk], id)
+	if len(c.items[pk]) == 0 {
+		delete(c.items, pk)
+	}
+	c.pruneChanges()
+}
+
+// current returns the item ch changed if that is still its latest version.
+func (c *container) current(ch change) *item {
+	if it := c.items[ch.pk][ch.id]; it != nil && it.lsn == ch.lsn {
+		return it
+	}
+	return nil
+}
+
+func (c *container) pruneChanges() {
+	if c.superseded <= len(c.changes)/2 {
+		return
+	}
+	c.changes = slices.DeleteFunc(c.changes, func(ch change) bool { return c.current(ch) == nil })
+	c.superseded = 0
+}
+
+// item is a stored document, system properties included. Its body is never
+// modified once stored, so it can be encoded without holding the lock.
+type item struct {
+	// seq orders items by creation, as their rids do.
+	seq uint64
+	// lsn is the LSN of the write that stored this version.
+	lsn  int64
+	body map[string]any
+}
+
+// NewAccount returns an empty account. o may be nil.
+func NewAccount(o *Options) *Account {
+	a := &Account{
+		now:       time.Now,
+		keys:      []string{Key},
+		databases: map[string]*database{},
+	}
+	if o != nil && o.Now != nil {
+		a.now = o.Now
+	}
+	if o != nil {
+		a.throughput = o.Throughput
+		a.emptyPages = o.EmptyPages
+	}
+	if o != nil && len(o.Keys) > 0 {
+		a.keys = append([]string(nil), o.Keys...)
+	}
+	return a
+}
+
+// CreateDatabase creates the database id if it does not exist yet.
+func (a *Account) CreateDatabase(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.databases[id]; ok {
+		return nil
+	}
+	if _, err := a.createDatabase(id); err != nil {
+		return err
+	}
+	return a.logErr
+}
+
+// CreateContainer creates the container id, and its database, if they do not
+// exist yet. The container is partitioned by partitionKeyPaths, by default
+// /id.
+func (a *Account) CreateContainer(databaseID, id string, partitionKeyPaths ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	db, ok := a.databases[databaseID]
+	if !ok {
+		var err error
+		if db, err = a.createDatabase(databaseID); err != nil {
+			return err
+		}
+	}
+	if _, ok := db.containers[id]; ok {
+		return nil
+	}
+	if len(partitionKeyPaths) == 0 {
+		partitionKeyPaths = []string{"/id"}
+	}
+	c, err := a.createContainer(db, id, partitionKeyPaths)
+	if err != nil {
+		return err
+	}
+	a.persist(containerRecord(db, c))
+	return a.logErr
+}
+
+func (a *Account) createDatabase(id string) (*database, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	a.nextRID++
+	rid := binary.LittleEndian.AppendUint32(nil, a.nextRID)
+	db := &database{
+		id:         id,
+		rid:        rid,
+		etag:       a.newETag(),
+		ts:         a.now().Unix(),
+		containers: map[string]*container{},
+	}
+	a.databases[id] = db
+	a.persist(databaseRecord(db))
+	return db, nil
+}
+
+// createContainer adds a container to db. The caller persists it once it is
+// fully configured.
+func (a *Account) createContainer(db *database, id string, partitionKeyPaths []string) (*container, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	a.nextRID++
+	// Container rids extend the rid of their database, as in Cosmos DB.
+	rid := binary.BigEndian.AppendUint32(append([]byte(nil), db.rid...), a.nextRID|0x80000000)
+	c := &container{
+		id:                id,
+		rid:               rid,
+		etag:              a.newETag(),
+		ts:                a.now().Unix(),
+		partitionKeyPaths: partitionKeyPaths,
+		items:             map[string]map[string]*item{},
+	}
+	c.budget.setThroughput(a.throughput, a.now())
+	db.containers[id] = c
+	return c, nil
+}
+
+// newETag returns a quoted etag in the format Cosmos DB uses.
+func (a *Account) newETag() string {
+	a.lsn++
+	return fmt.Sprintf(`"%08x-0000-0000-0000-%012x"`, a.now().Unix(), a.lsn)
+}
+
+func ridString(rid []byte) string {
+	return base64.StdEncoding.EncodeToString(rid)
+}
+
+func validateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("id must not be empty")
+	}
+	for _, c := range id {
+		switch c {
+		case '/', '\\', '?', '#':
+			return fmt.Errorf("id %q contains the invalid character %q", id, c)
+		}
+	}
+	return nil
+}
+
+// Server serves an Account over HTTP on a local port.
+type Server struct {
+	*httptest.Server
+	Account *Account
+}
+
+// NewServer starts a server for a new, empty account. o may be nil. Close the
+// server when done.
+func NewServer(o *Options) *Server {
+	account := NewAccount(o)
+	return &Server{
+		Server:  httptest.NewServer(account),
+		Account: account,
+	}
+}
+
+// Client returns an azcosmos client of the server that signs requests with
+// Key. o may be nil; its Transport, if set, sends the requests, so tests can
+// observe or alter them.
+func (s *Server) Client(o *azcosmos.ClientOptions) (*azcosmos.Client, error) {
+	cred, err := azcosmos.NewKeyCredential(Key)
+	if err != nil {
+		return nil, err
+	}
+	return azcosmos.NewClientWithKey(s.URL, cred, o)
+}
+
+// ContainerClient returns a client of the container id of the database
+// databaseID, as Client configures it. The container must exist, for example
+// through Account.CreateContainer.
+func (s *Server) ContainerClient(databaseID, id string, o *azcosmos.ClientOptions) (*azcosmos.ContainerClient, error) {
+	client, err := s.Client(o)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewContainer(databaseID, id)
+}
+
+// ServeHTTP implements http.Handler.
+func (a *Account) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := parseRequest(r)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, "BadRequest", err.Error()).write(w, r)
+		return
+	}
+	a.mu.Lock()
+	resp := a.authorize(req)
+	if resp == nil && a.logErr != nil {
+		resp = errorResponse(http.StatusInternalServerError, "InternalServerError", a.logErr.Error())
+	}
+	if resp == nil {
+		resp = a.route(req)
+	}
+	a.mu.Unlock()
+	resp.write(w, r)
+}
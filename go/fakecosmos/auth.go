@@ -0,0 +1,97 @@
+package fakecosmos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxClockSkew is how far x-ms-date may be from the server's clock, as in
+// Cosmos DB.
+const maxClockSkew = 15 * time.Minute
+
+// SetKeys replaces the keys the account accepts. Pass the old and the new key
+// to test a client through a key rotation.
+func (a *Account) SetKeys(keys ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = append([]string(nil), keys...)
+}
+
+// authorize verifies the master key signature of req. It returns nil if the
+// request is authorized and the error response otherwise.
+func (a *Account) authorize(req *request) *response {
+	date := req.header.Get("x-ms-date")
+	if date == "" {
+		date = req.header.Get("Date")
+	}
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return errorResponse(http.StatusUnauthorized, "Unauthorized",
+			"The input date header is invalid format. Please pass in RFC 1123 style date format.")
+	}
+	if now := a.now(); t.Before(now.Add(-maxClockSkew)) || t.After(now.Add(maxClockSkew)) {
+		return errorResponse(http.StatusForbidden, "Forbidden", fmt.Sprintf(
+			"The authorization token is not valid at the current time. Please create another token and retry (token start time: %s, token expiry time: %s, current server time: %s).",
+			date, t.Add(maxClockSkew).Format(http.TimeFormat), now.UTC().Format(http.TimeFormat)))
+	}
+
+	payload := req.stringToSign(date)
+	auth, err := url.QueryUnescape(req.header.Get("Authorization"))
+	if err != nil || auth == "" {
+		return errorResponse(http.StatusUnauthorized, "Unauthorized", "Required Header authorization is missing. Ensure a valid Authorization token is passed.")
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(auth, "&") {
+		// The signature is base64 and may itself end in '='.
+		name, value, _ := strings.Cut(field, "=")
+		fields[name] = value
+	}
+	if fields["type"] != "master" || fields["ver"] != "1.0" {
+		return errorResponse(http.StatusUnauthorized, "Unauthorized", "The authorization token type is not supported. Only master key tokens are accepted.")
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields["sig"])
+	if err == nil {
+		for _, key := range a.keys {
+			if hmac.Equal(sig, sign(key, payload)) {
+				return nil
+			}
+		}
+	}
+	return errorResponse(http.StatusUnauthorized, "Unauthorized", fmt.Sprintf(
+		"The input authorization token can't serve the request. The wrong key is being used or the expected payload is not built as per the protocol. For more info: https://aka.ms/cosmosdb-tsg-mac-token\r\nServer used the following payload to sign: '%s'",
+		payload))
+}
+
+// stringToSign returns the payload a client signs for req. For a feed, such as
+// dbs/db/colls, the resource type is the last segment and the link is its
+// owner; for a resource, such as dbs/db/colls/c, the type is the segment
+// naming its kind and the link is the whole path.
+func (req *request) stringToSign(date string) string {
+	var resourceType, link string
+	if n := len(req.segments); n%2 == 1 {
+		resourceType = req.segments[n-1]
+		link = strings.Join(req.segments[:n-1], "/")
+	} else if n > 0 {
+		resourceType = req.segments[n-2]
+		link = strings.Join(req.segments, "/")
+	}
+	return strings.ToLower(req.method) + "\n" + strings.ToLower(resourceType) + "\n" + link + "\n" + strings.ToLower(date) + "\n\n"
+}
+
+// sign returns the HMAC-SHA256 of payload with the base64 encoded key. An
+// invalid key signs nothing.
+func sign(key, payload string) []byte {
+	k, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil
+	}
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,75 @@
+package fakecosmos
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest returns a request listing the databases, signed with key at
+// date.
+func signedRequest(key string, date time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/dbs", nil)
+	signRequest(r, key, date)
+	return r
+}
+
+// signRequest signs r with key at date, as the SDK does.
+func signRequest(r *http.Request, key string, date time.Time) {
+	d := date.UTC().Format(http.TimeFormat)
+	r.Header.Set("x-ms-date", d)
+	req := &request{method: r.Method, segments: strings.Split(strings.Trim(r.URL.Path, "/"), "/")}
+	sig := base64.StdEncoding.EncodeToString(sign(key, req.stringToSign(d)))
+	r.Header.Set("Authorization", url.QueryEscape("type=master&ver=1.0&sig="+sig))
+}
+
+func TestAuthorize(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := NewAccount(&Options{Now: func() time.Time { return now }})
+	secondary := base64.StdEncoding.EncodeToString([]byte("the secondary key of the account"))
+	wrong := base64.StdEncoding.EncodeToString([]byte("a key the account never had"))
+	status := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w.Code
+	}
+	check := func(name string, r *http.Request, want int) {
+		t.Helper()
+		if got := status(r); got != want {
+			t.Errorf("%s: status %d, want %d", name, got, want)
+		}
+	}
+
+	check("primary key", signedRequest(Key, now), http.StatusOK)
+	check("wrong key", signedRequest(wrong, now), http.StatusUnauthorized)
+	check("secondary key before rotation", signedRequest(secondary, now), http.StatusUnauthorized)
+
+	a.SetKeys(Key, secondary)
+	check("primary key during rotation", signedRequest(Key, now), http.StatusOK)
+	check("secondary key during rotation", signedRequest(secondary, now), http.StatusOK)
+	a.SetKeys(secondary)
+	check("removed primary key", signedRequest(Key, now), http.StatusUnauthorized)
+	check("secondary key after rotation", signedRequest(secondary, now), http.StatusOK)
+
+	check("date within the skew", signedRequest(secondary, now.Add(maxClockSkew-time.Second)), http.StatusOK)
+	check("date ahead of the skew", signedRequest(secondary, now.Add(maxClockSkew+time.Second)), http.StatusForbidden)
+	check("date behind the skew", signedRequest(secondary, now.Add(-maxClockSkew-time.Second)), http.StatusForbidden)
+
+	r := signedRequest(secondary, now)
+	r.Header.Del("x-ms-date")
+	check("no date", r, http.StatusUnauthorized)
+	r = signedRequest(secondary, now)
+	r.Header.Del("Authorization")
+	check("no signature", r, http.StatusUnauthorized)
+	r = signedRequest(secondary, now)
+	r.Header.Set("Authorization", url.QueryEscape("type=resource&ver=1.0&sig=abc"))
+	check("resource token", r, http.StatusUnauthorized)
+	// The signature covers the date, so replaying it at another time fails.
+	r = signedRequest(secondary, now)
+	r.Header.Set("x-ms-date", now.Add(time.Second).Format(http.TimeFormat))
+	check("changed date", r, http.StatusUnauthorized)
+}
@@ -0,0 +1,175 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// maxBatchOperations is the most operations a transactional batch may have.
+const maxBatchOperations = 100
+
+// batchOperation is an operation of a transactional batch, as the SDK encodes
+// it.
+type batchOperation struct {
+	OperationType string          `json:"operationType"`
+	ID            string          `json:"id"`
+	IfMatch       string          `json:"ifMatch"`
+	ResourceBody  json.RawMessage `json:"resourceBody"`
+}
+
+// batchResult is the outcome of one operation of a transactional batch.
+type batchResult struct {
+	StatusCode    int     `json:"statusCode"`
+	RequestCharge float64 `json:"requestCharge"`
+	ETag          string  `json:"eTag,omitempty"`
+	ResourceBody  any     `json:"resourceBody,omitempty"`
+}
+
+// batchWrite is a change made by a transactional batch: a new version of the
+// item id, or its deletion if it is nil.
+type batchWrite struct {
+	id string
+	it *item
+}
+
+// batch runs a transactional batch: operations on one logical partition that
+// all apply or, if any fails, none do. Operations see the writes of earlier
+// ones. A batch that fails returns 207 Multi-Status with the status of the
+// operation that failed and 424 Failed Dependency for the others.
+func (a *Account) batch(req *request, db *database, c *container) *response {
+	pk, ok, err := req.partitionKey()
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	if !ok {
+		return badRequest("PartitionKey value must be supplied for this operation.")
+	}
+	var ops []batchOperation
+	if err := json.Unmarshal(req.body, &ops); err != nil {
+		return badRequest("The input content is invalid: %v", err)
+	}
+	if len(ops) == 0 || len(ops) > maxBatchOperations {
+		return badRequest("Batch request must have between 1 and %d operations.", maxBatchOperations)
+	}
+	minimal := strings.EqualFold(req.header.Get(headerPrefer), preferReturnMinimal)
+
+	// Run the operations against a copy of the partition, and undo the
+	// counters they advanced if one fails.
+	lsn, nextDocRID := a.lsn, c.nextDocRID
+	partition := maps.Clone(c.items[pk])
+	if partition == nil {
+		partition = map[string]*item{}
+	}
+	results := make([]batchResult, len(ops))
+	var writes []batchWrite
+	charge := 0.0
+	for i := range ops {
+		result, write := a.batchOperation(db, c, pk, partition, &ops[i], minimal)
+		results[i] = result
+		charge += result.RequestCharge
+		if result.StatusCode >= 400 {
+			a.lsn, c.nextDocRID = lsn, nextDocRID
+			for j := range results {
+				if j != i {
+					results[j] = batchResult{StatusCode: http.StatusFailedDependency}
+				}
+			}
+			return newResponse(http.StatusMultiStatus, results).setCharge(charge)
+		}
+		if write != nil {
+			writes = append(writes, *write)
+		}
+	}
+
+	recs := make([]*logRecord, len(writes))
+	for i, w := range writes {
+		if w.it == nil {
+			c.deleteItem(pk, w.id)
+			recs[i] = &logRecord{Op: opDeleteItem, Database: db.id, Container: c.id, PartitionKey: pk, ID: w.id}
+		} else {
+			c.setItem(pk, w.it)
+			recs[i] = itemRecord(db, c, pk, w.it)
+		}
+	}
+	a.persist(recs...)
+	resp := newResponse(http.StatusOK, results).setCharge(charge)
+	a.setSession(resp)
+	return resp
+}
+
+// batchOperation runs one operation of a batch against partition, updating it
+// with the write the operation makes, if any.
+func (a *Account) batchOperation(db *database, c *container, pk string, partition map[string]*item, op *batchOperation, minimal bool) (batchResult, *batchWrite) {
+	fail := func(resp *response) (batchResult, *batchWrite) {
+		return batchResult{StatusCode: resp.status}, nil
+	}
+	result := func(status int, charge float64, it *item, body bool) batchResult {
+		r := batchResult{StatusCode: status, RequestCharge: charge, ETag: it.etag()}
+		if body {
+			r.ResourceBody = it.body
+		}
+		return r
+	}
+
+	kind := strings.ToLower(op.OperationType)
+	switch kind {
+	case "create", "upsert", "replace":
+		doc := map[string]any{}
+		if err := json.Unmarshal(op.ResourceBody, &doc); err != nil {
+			return fail(badRequest("The input content is invalid: %v", err))
+		}
+		id, ok := doc["id"].(string)
+		if !ok || validateID(id) != nil || kind == "replace" && id != op.ID {
+			return fail(badRequest("invalid id"))
+		}
+		if c.partitionKey(doc) != pk {
+			return fail(badRequest("PartitionKey extracted from document doesn't match the one specified in the header."))
+		}
+		existing := partition[id]
+		status := http.StatusCreated
+		switch {
+		case kind == "create" && existing != nil:
+			return fail(conflict())
+		case kind == "replace" && existing == nil:
+			return fail(notFound())
+		case existing != nil:
+			if resp := checkIfMatch(op.IfMatch, existing); resp != nil {
+				return fail(resp)
+			}
+			status = http.StatusOK
+		}
+		it := a.newItem(db, c, doc, existing)
+		partition[id] = it
+		return result(status, chargeWritePerKB*kilobytes(it.body), it, !minimal), &batchWrite{id: id, it: it}
+	}
+
+	existing := partition[op.ID]
+	if existing == nil {
+		return fail(notFound())
+	}
+	switch kind {
+	case "read":
+		return result(http.StatusOK, chargeReadPerKB*kilobytes(existing.body), existing, true), nil
+	case "delete":
+		if resp := checkIfMatch(op.IfMatch, existing); resp != nil {
+			return fail(resp)
+		}
+		a.lsn++
+		delete(partition, op.ID)
+		return batchResult{StatusCode: http.StatusNoContent, RequestCharge: chargeDelete}, &batchWrite{id: op.ID}
+	case "patch":
+		if resp := checkIfMatch(op.IfMatch, existing); resp != nil {
+			return fail(resp)
+		}
+		doc, resp := c.patch(pk, existing.body, op.ResourceBody)
+		if resp != nil {
+			return fail(resp)
+		}
+		it := a.newItem(db, c, doc, existing)
+		partition[op.ID] = it
+		return result(http.StatusOK, chargeWritePerKB*kilobytes(it.body), it, !minimal), &batchWrite{id: op.ID, it: it}
+	}
+	return fail(badRequest("Unknown operation type %s.", op.OperationType))
+}
@@ -0,0 +1,73 @@
+package fakecosmos
+
+import (
+	"maps"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// changeFeed serves an incremental change feed request: a GET of a
+// container's documents with A-IM: Incremental feed. It returns the latest
+// version of every item written after the LSN in If-None-Match, in the order
+// of the writes, with an ETag to pass as If-None-Match for the next page. An
+// If-None-Match of * starts from now and no If-None-Match starts from the
+// beginning. Deletes are not reported, as in Cosmos DB's latest version mode.
+func (a *Account) changeFeed(req *request, c *container) *response {
+	pk, single, err := req.partitionKey()
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	if r := req.header.Get(headerPKRangeID); r != "" && r != "0" {
+		resp := errorResponse(http.StatusGone, "Gone", "The requested partition key range is gone.")
+		resp.header.Set(headerSubstatus, "1002")
+		return resp
+	}
+	since := int64(0)
+	switch inm := req.header.Get(headerIfNoneMatch); inm {
+	case "":
+	case "*":
+		since = a.lsn
+	default:
+		since, err = strconv.ParseInt(strings.Trim(inm, `"`), 10, 64)
+		if err != nil || since < 0 {
+			return badRequest("Invalid change feed continuation %s", inm)
+		}
+	}
+
+	maxItems := req.maxItemCount()
+	var results []any
+	// Unless the page fills up, the whole log is read, so the next page
+	// starts after the latest write even if it was to another partition.
+	next, last := max(since, a.lsn), since
+	start := sort.Search(len(c.changes), func(i int) bool { return c.changes[i].lsn > since })
+	for _, ch := range c.changes[start:] {
+		if single && ch.pk != pk {
+			continue
+		}
+		it := c.current(ch)
+		if it == nil {
+			continue
+		}
+		if len(results) == maxItems {
+			next = last
+			break
+		}
+		doc := maps.Clone(it.body)
+		doc["_lsn"] = it.lsn
+		results = append(results, doc)
+		last = it.lsn
+	}
+
+	var resp *response
+	if len(results) == 0 {
+		resp = newResponse(http.StatusNotModified, nil).setCharge(chargeChangeFeedNotModified)
+	} else {
+		resp = feedResponse(ridString(c.rid), "Documents", results)
+		resp.setCharge(chargeQueryBase + chargeQueryPerKB*kilobytes(results))
+	}
+	resp.header.Set("etag", strconv.Quote(strconv.FormatInt(next, 10)))
+	a.setSession(resp)
+	return resp
+}
@@ -0,0 +1,113 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// readChangeFeed reads a page of the change feed of test/items from
+// ifNoneMatch, in the partition pk unless it is empty. It returns the status,
+// the id and version of each change, and the etag to read on from.
+func readChangeFeed(t *testing.T, a *Account, pk, ifNoneMatch string) (status int, changes []string, etag string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/dbs/test/colls/items/docs", nil)
+	r.Header.Set(headerAIM, "Incremental feed")
+	if pk != "" {
+		r.Header.Set("x-ms-documentdb-partitionkey", fmt.Sprintf("[%q]", pk))
+	}
+	if ifNoneMatch != "" {
+		r.Header.Set(headerIfNoneMatch, ifNoneMatch)
+	}
+	signRequest(r, Key, time.Now())
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		var feed struct {
+			Documents []struct {
+				ID string `json:"id"`
+				V  int    `json:"v"`
+			}
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		for _, doc := range feed.Documents {
+			changes = append(changes, fmt.Sprintf("%s@%d", doc.ID, doc.V))
+		}
+	}
+	return w.Code, changes, w.Header().Get("etag")
+}
+
+func TestChangeFeed(t *testing.T) {
+	ctx := testContext(t)
+	c, srv := newTestContainer(t, nil, nil)
+	upsert := func(pk, id string, v int) {
+		t.Helper()
+		item, _ := json.Marshal(map[string]any{"id": id, "pk": pk, "v": v})
+		if _, err := c.UpsertItem(ctx, azcosmos.NewPartitionKeyString(pk), item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remove := func(pk, id string) {
+		t.Helper()
+		if _, err := c.DeleteItem(ctx, azcosmos.NewPartitionKeyString(pk), id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(name string, gotStatus int, got []string, wantStatus int, want []string) {
+		t.Helper()
+		if gotStatus != wantStatus || !slices.Equal(got, want) {
+			t.Errorf("%s: status %d, changes %q; want %d, %q", name, gotStatus, got, wantStatus, want)
+		}
+	}
+
+	upsert("p", "a", 1)
+	upsert("p", "b", 1)
+	upsert("q", "c", 1)
+	status, changes, first := readChangeFeed(t, srv.Account, "", "")
+	check("from the beginning", status, changes, http.StatusOK, []string{"a@1", "b@1", "c@1"})
+
+	// An incremental read returns only what changed after the etag, in
+	// the order of the writes.
+	upsert("p", "b", 2)
+	upsert("p", "d", 1)
+	status, changes, second := readChangeFeed(t, srv.Account, "", first)
+	check("after the first read", status, changes, http.StatusOK, []string{"b@2", "d@1"})
+
+	// Nothing changed after the latest LSN.
+	status, changes, etag := readChangeFeed(t, srv.Account, "", second)
+	check("at the latest LSN", status, changes, http.StatusNotModified, nil)
+	if etag != second {
+		t.Errorf("etag of an unchanged feed = %s, want %s", etag, second)
+	}
+	status, changes, _ = readChangeFeed(t, srv.Account, "", "*")
+	check("from now", status, changes, http.StatusNotModified, nil)
+
+	// Updates collapse to the latest version, at the position of its write,
+	// and deletes drop the item from the feed.
+	upsert("p", "a", 2)
+	upsert("p", "a", 3)
+	remove("p", "d")
+	remove("q", "c")
+	status, changes, _ = readChangeFeed(t, srv.Account, "", "")
+	check("from the beginning after updates and deletes", status, changes, http.StatusOK, []string{"b@2", "a@3"})
+	status, changes, _ = readChangeFeed(t, srv.Account, "", second)
+	check("after the second read", status, changes, http.StatusOK, []string{"a@3"})
+
+	// A partition's feed skips the changes of the others.
+	upsert("q", "e", 1)
+	status, changes, _ = readChangeFeed(t, srv.Account, "p", second)
+	check("partition p", status, changes, http.StatusOK, []string{"a@3"})
+	status, changes, _ = readChangeFeed(t, srv.Account, "q", "")
+	check("partition q", status, changes, http.StatusOK, []string{"e@1"})
+
+	status, _, _ = readChangeFeed(t, srv.Account, "", `"not an lsn"`)
+	check("invalid etag", status, nil, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,224 @@
+package fakecosmos
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// REST API headers handled by the fake.
+const (
+	headerActivityID      = "x-ms-activity-id"
+	headerRequestCharge   = "x-ms-request-charge"
+	headerSessionToken    = "x-ms-session-token"
+	headerItemCount       = "x-ms-item-count"
+	headerSubstatus       = "x-ms-substatus"
+	headerPartitionKey    = "x-ms-documentdb-partitionkey"
+	headerIsUpsert        = "x-ms-documentdb-is-upsert"
+	headerIsQuery         = "x-ms-documentdb-isquery"
+	headerIsBatchRequest  = "x-ms-cosmos-is-batch-request"
+	headerEnableCrossPart = "x-ms-documentdb-query-enablecrosspartition"
+	headerMaxItemCount    = "x-ms-max-item-count"
+	headerContinuation    = "x-ms-continuation"
+	headerLSN             = "lsn"
+	headerGatewayVersion  = "x-ms-gatewayversion"
+	headerPrefer          = "Prefer"
+	headerIfMatch         = "If-Match"
+	headerIfNoneMatch     = "If-None-Match"
+	headerAIM             = "A-IM"
+	headerPKRangeID       = "x-ms-documentdb-partitionkeyrangeid"
+	incrementalFeed       = "Incremental feed"
+	contentTypeQueryJSON  = "application/query+json"
+	headerRetryAfterMS    = "x-ms-retry-after-ms"
+	preferReturnMinimal   = "return=minimal"
+)
+
+// request is a parsed REST request.
+type request struct {
+	method string
+	// endpoint is the URL of the server the request was sent to, such as
+	// https://localhost:8081/.
+	endpoint string
+	// segments are the unescaped segments of the resource path, such as
+	// dbs, db1, colls, c1, docs, item1.
+	segments []string
+	header   http.Header
+	body     []byte
+}
+
+func parseRequest(r *http.Request) (*request, error) {
+	var segments []string
+	for _, s := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		if s == "" {
+			continue
+		}
+		u, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path segment %q", s)
+		}
+		segments = append(segments, u)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &request{method: r.Method, endpoint: scheme + "://" + r.Host + "/", segments: segments, header: r.Header, body: body}, nil
+}
+
+// response is a REST response waiting to be written.
+type response struct {
+	status int
+	header http.Header
+	// body is encoded as JSON unless it is nil.
+	body any
+}
+
+func newResponse(status int, body any) *response {
+	return &response{status: status, header: http.Header{}, body: body}
+}
+
+// errorResponse returns an error in the format of the Cosmos DB gateway.
+func errorResponse(status int, code, message string) *response {
+	resp := newResponse(status, map[string]string{
+		"code":    code,
+		"message": fmt.Sprintf("Message: {\"Errors\":[%q]}", message),
+	})
+	resp.header.Set(headerSubstatus, "0")
+	return resp
+}
+
+func notFound() *response {
+	return errorResponse(http.StatusNotFound, "NotFound", "Resource Not Found. Learn more: https://aka.ms/cosmosdb-tsg-not-found")
+}
+
+func badRequest(format string, args ...any) *response {
+	return errorResponse(http.StatusBadRequest, "BadRequest", fmt.Sprintf(format, args...))
+}
+
+func (resp *response) write(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	for k, v := range resp.header {
+		h[k] = v
+	}
+	if h.Get(headerActivityID) == "" {
+		h.Set(headerActivityID, newActivityID())
+	}
+	if h.Get(headerRequestCharge) == "" {
+		h.Set(headerRequestCharge, "0")
+	}
+	h.Set(headerGatewayVersion, "2.0.0")
+	if resp.body == nil {
+		w.WriteHeader(resp.status)
+		return
+	}
+	body, err := json.Marshal(resp.body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(resp.status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func newActivityID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (resp *response) setCharge(charge float64) *response {
+	resp.header.Set(headerRequestCharge, strconv.FormatFloat(charge, 'f', 2, 64))
+	return resp
+}
+
+// route dispatches a request on its resource path. It runs with a.mu held.
+func (a *Account) route(req *request) *response {
+	s := req.segments
+	switch {
+	case len(s) == 0:
+		if req.method != http.MethodGet {
+			return methodNotAllowed()
+		}
+		return a.readAccount(req)
+	case s[0] != "dbs":
+		return notFound()
+	case len(s) == 1:
+		return a.databaseFeed(req)
+	}
+
+	db, ok := a.databases[s[1]]
+	switch {
+	case len(s) == 2:
+		return a.databaseResource(req, db, s[1])
+	case !ok:
+		return notFound()
+	case s[2] != "colls":
+		return notFound()
+	case len(s) == 3:
+		return a.containerFeed(req, db)
+	}
+
+	c, ok := db.containers[s[3]]
+	switch {
+	case len(s) == 4:
+		return a.containerResource(req, db, c, s[3])
+	case !ok:
+		return notFound()
+	case len(s) == 5 && s[4] == "pkranges":
+		return a.readPartitionKeyRanges(req, db, c)
+	case s[4] != "docs" || len(s) > 6:
+		return notFound()
+	}
+
+	a.expireItems(db, c)
+	// Only item operations consume the container's throughput.
+	if resp := c.budget.admit(a.now()); resp != nil {
+		return resp
+	}
+	var resp *response
+	if len(s) == 5 {
+		resp = a.itemFeed(req, db, c)
+	} else {
+		resp = a.itemResource(req, db, c, s[5])
+	}
+	c.budget.consume(resp)
+	return resp
+}
+
+func methodNotAllowed() *response {
+	return errorResponse(http.StatusMethodNotAllowed, "MethodNotAllowed", "The requested verb is not supported.")
+}
+
+// readAccount returns the account properties the SDK reads on startup. The
+// account has one region whose endpoint is the server itself, over HTTPS if
+// the request came over TLS.
+func (a *Account) readAccount(req *request) *response {
+	region := map[string]any{"name": "Fake Region", "databaseAccountEndpoint": req.endpoint}
+	return newResponse(http.StatusOK, map[string]any{
+		"id":                           "fake",
+		"_self":                        "",
+		"_rid":                         "fake.documents.localhost",
+		"media":                        "//media/",
+		"addresses":                    "//addresses/",
+		"_dbs":                         "//dbs/",
+		"writableLocations":            []any{region},
+		"readableLocations":            []any{region},
+		"enableMultipleWriteLocations": false,
+		"userConsistencyPolicy":        map[string]any{"defaultConsistencyLevel": "Session"},
+	})
+}
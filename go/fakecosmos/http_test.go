@@ -0,0 +1,125 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+func TestItemCRUD(t *testing.T) {
+	ctx := testContext(t)
+	c, _ := newTestContainer(t, nil, nil)
+	pk := azcosmos.NewPartitionKeyString("p1")
+	read := func() (map[string]any, error) {
+		resp, err := c.ReadItem(ctx, pk, "a", nil)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		return doc, json.Unmarshal(resp.Value, &doc)
+	}
+
+	created, err := c.CreateItem(ctx, pk, []byte(`{"id": "a", "pk": "p1", "n": 1}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateItem(ctx, pk, []byte(`{"id": "a", "pk": "p1"}`), nil); !isConflict(err) {
+		t.Errorf("second create: error = %v, want 409", err)
+	}
+	doc, err := read()
+	if err != nil || doc["n"] != float64(1) || doc["_etag"] != string(created.ETag) {
+		t.Errorf("read after create = %v, %v; want n 1 and etag %s", doc, err, created.ETag)
+	}
+
+	// A replace must match the current etag.
+	replaced, err := c.ReplaceItem(ctx, pk, "a", []byte(`{"id": "a", "pk": "p1", "n": 2}`), &azcosmos.ItemOptions{IfMatchEtag: &created.ETag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReplaceItem(ctx, pk, "a", []byte(`{"id": "a", "pk": "p1", "n": 3}`), &azcosmos.ItemOptions{IfMatchEtag: &created.ETag}); statusOf(err) != http.StatusPreconditionFailed {
+		t.Errorf("replace with a stale etag: error = %v, want 412", err)
+	}
+	if replaced.ETag == created.ETag {
+		t.Errorf("replace kept the etag %s", created.ETag)
+	}
+	if _, err := c.UpsertItem(ctx, pk, []byte(`{"id": "a", "pk": "p1", "n": 4}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := read(); err != nil || doc["n"] != float64(4) {
+		t.Errorf("read after upsert = %v, %v; want n 4", doc, err)
+	}
+
+	// Items are addressed by partition key and id.
+	if _, err := c.ReadItem(ctx, azcosmos.NewPartitionKeyString("p2"), "a", nil); !isNotFound(err) {
+		t.Errorf("read in another partition: error = %v, want 404", err)
+	}
+	if _, err := c.DeleteItem(ctx, pk, "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := read(); !isNotFound(err) {
+		t.Errorf("read after delete: error = %v, want 404", err)
+	}
+	if _, err := c.DeleteItem(ctx, pk, "a", nil); !isNotFound(err) {
+		t.Errorf("second delete: error = %v, want 404", err)
+	}
+}
+
+func TestReadAccount(t *testing.T) {
+	tests := []struct {
+		name      string
+		newServer func(http.Handler) *httptest.Server
+	}{
+		{"http", httptest.NewServer},
+		{"https", httptest.NewTLSServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext(t)
+			a := NewAccount(nil)
+			if err := a.CreateContainer("test", "items", "/pk"); err != nil {
+				t.Fatal(err)
+			}
+			srv := &Server{Server: tt.newServer(a), Account: a}
+			t.Cleanup(srv.Close)
+
+			// The account's region is the server itself, so the SDK sends
+			// every later request to it.
+			r := httptest.NewRequest(http.MethodGet, srv.URL+"/", nil)
+			r.RequestURI = ""
+			signRequest(r, Key, time.Now())
+			resp, err := srv.Server.Client().Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var account struct {
+				WritableLocations []struct {
+					Endpoint string `json:"databaseAccountEndpoint"`
+				}
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+				t.Fatal(err)
+			}
+			if len(account.WritableLocations) != 1 || account.WritableLocations[0].Endpoint != srv.URL+"/" {
+				t.Errorf("writable locations = %+v, want %s/", account.WritableLocations, srv.URL)
+			}
+
+			c, err := srv.ContainerClient("test", "items", &azcosmos.ClientOptions{
+				ClientOptions: azcore.ClientOptions{Transport: srv.Server.Client(), Retry: policy.RetryOptions{MaxRetries: -1}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeItems(ctx, t, c, "p1", "a")
+			if _, err := c.ReadItem(ctx, azcosmos.NewPartitionKeyString("p1"), "a", nil); err != nil {
+				t.Errorf("read over %s: %v", tt.name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package fakecosmos
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// partitionKey returns the partition key of a request, normalized to the
+// encoding used by the container's items map. ok is false if the request
+// has no partition key.
+func (req *request) partitionKey() (pk string, ok bool, err error) {
+	h := req.header.Get(headerPartitionKey)
+	if h == "" {
+		return "", false, nil
+	}
+	var values []any
+	if err := json.Unmarshal([]byte(h), &values); err != nil {
+		return "", false, fmt.Errorf("invalid partition key %s", h)
+	}
+	b, _ := json.Marshal(values)
+	return string(b), true, nil
+}
+
+// partitionKey returns the encoded partition key of doc. Missing values are
+// undefined, which Cosmos DB encodes as an empty object.
+func (c *container) partitionKey(doc map[string]any) string {
+	values := make([]any, len(c.partitionKeyPaths))
+	for i, p := range c.partitionKeyPaths {
+		var v any = doc
+		for _, prop := range strings.Split(strings.Trim(p, "/"), "/") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				v = nil
+				break
+			}
+			v = m[prop]
+		}
+		if v == nil {
+			v = map[string]any{}
+		}
+		values[i] = v
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// itemFeed serves dbs/{db}/colls/{coll}/docs.
+func (a *Account) itemFeed(req *request, db *database, c *container) *response {
+	switch {
+	case req.method == http.MethodGet && strings.EqualFold(req.header.Get(headerAIM), incrementalFeed):
+		return a.changeFeed(req, c)
+	case req.method == http.MethodGet:
+		return a.readItems(req, c)
+	case req.method == http.MethodPost && req.isQuery():
+		return a.queryItems(req, c)
+	case req.method == http.MethodPost && req.header.Get(headerIsBatchRequest) != "":
+		return a.batch(req, db, c)
+	case req.method == http.MethodPost:
+		return a.writeItem(req, db, c, "")
+	}
+	return methodNotAllowed()
+}
+
+// itemResource serves dbs/{db}/colls/{coll}/docs/{id}.
+func (a *Account) itemResource(req *request, db *database, c *container, id string) *response {
+	pk, ok, err := req.partitionKey()
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	if !ok {
+		return badRequest("PartitionKey value must be supplied for this operation.")
+	}
+	it := c.items[pk][id]
+
+	switch req.method {
+	case http.MethodGet:
+		if it == nil {
+			return notFound().setCharge(chargeReadPerKB)
+		}
+		if inm := req.header.Get(headerIfNoneMatch); inm != "" && (inm == "*" || inm == it.etag()) {
+			return a.itemResponse(http.StatusNotModified, nil, it)
+		}
+		return a.itemResponse(http.StatusOK, req, it).setCharge(chargeReadPerKB * kilobytes(it.body))
+	case http.MethodPut:
+		if it == nil {
+			return notFound().setCharge(chargeReadPerKB)
+		}
+		return a.writeItem(req, db, c, id)
+	case http.MethodPatch:
+		if it == nil {
+			return notFound().setCharge(chargeReadPerKB)
+		}
+		return a.patchItem(req, db, c, pk, it)
+	case http.MethodDelete:
+		if it == nil {
+			return notFound().setCharge(chargeReadPerKB)
+		}
+		if resp := checkIfMatch(req.header.Get(headerIfMatch), it); resp != nil {
+			return resp
+		}
+		a.lsn++
+		c.deleteItem(pk, id)
+		a.persist(&logRecord{Op: opDeleteItem, Database: db.id, Container: c.id, PartitionKey: pk, ID: id})
+		resp := newResponse(http.StatusNoContent, nil).setCharge(chargeDelete)
+		a.setSession(resp)
+		return resp
+	}
+	return methodNotAllowed()
+}
+
+// writeItem creates, upserts or, when replaceID is set, replaces an item.
+func (a *Account) writeItem(req *request, db *database, c *container, replaceID string) *response {
+	doc := map[string]any{}
+	if err := json.Unmarshal(req.body, &doc); err != nil {
+		return badRequest("The input content is invalid: %v", err)
+	}
+	id, ok := doc["id"].(string)
+	if !ok {
+		return badRequest("The input content is invalid because the required properties - 'id; ' - are missing")
+	}
+	if err := validateID(id); err != nil {
+		return badRequest("%v", err)
+	}
+	if replaceID != "" && id != replaceID {
+		return badRequest("The id of the item does not match the id in the request path.")
+	}
+	pk, ok, err := req.partitionKey()
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	if docPK := c.partitionKey(doc); ok && pk != docPK {
+		return badRequest("PartitionKey extracted from document doesn't match the one specified in the header.")
+	} else if !ok {
+		pk = docPK
+	}
+
+	existing := c.items[pk][id]
+	status := http.StatusCreated
+	switch {
+	case replaceID != "":
+		if existing == nil {
+			return notFound()
+		}
+		status = http.StatusOK
+	case existing != nil && !strings.EqualFold(req.header.Get(headerIsUpsert), "true"):
+		return conflict().setCharge(chargeWritePerKB)
+	case existing != nil:
+		status = http.StatusOK
+	}
+	if existing != nil {
+		if resp := checkIfMatch(req.header.Get(headerIfMatch), existing); resp != nil {
+			return resp
+		}
+	}
+
+	it := a.newItem(db, c, doc, existing)
+	c.setItem(pk, it)
+	a.persist(itemRecord(db, c, pk, it))
+	resp := a.itemResponse(status, req, it).setCharge(chargeWritePerKB * kilobytes(it.body))
+	a.setSession(resp)
+	return resp
+}
+
+// newItem adds the system properties to doc. An item keeps its rid when it is
+// replaced.
+func (a *Account) newItem(db *database, c *container, doc map[string]any, replaced *item) *item {
+	it := &item{body: doc}
+	if replaced != nil {
+		it.seq = replaced.seq
+	} else {
+		c.nextDocRID++
+		it.seq = c.nextDocRID
+	}
+	rid := ridString(binary.LittleEndian.AppendUint64(bytes.Clone(c.rid), it.seq))
+	doc["_rid"] = rid
+	doc["_self"] = "dbs/" + ridString(db.rid) + "/colls/" + ridString(c.rid) + "/docs/" + rid + "/"
+	doc["_etag"] = a.newETag()
+	it.lsn = a.lsn
+	doc["_attachments"] = "attachments/"
+	// A float64, like every number decoded from JSON, so that queries and
+	// patch conditions compare it as a number.
+	doc["_ts"] = float64(a.now().Unix())
+	return it
+}
+
+func (it *item) etag() string {
+	etag, _ := it.body["_etag"].(string)
+	return etag
+}
+
+// itemResponse returns it, or no body if the request prefers a minimal
+// response. req may be nil to always omit the body.
+func (a *Account) itemResponse(status int, req *request, it *item) *response {
+	var body any
+	if req != nil && !strings.EqualFold(req.header.Get(headerPrefer), preferReturnMinimal) {
+		body = it.body
+	}
+	resp := newResponse(status, body)
+	resp.header.Set("etag", it.etag())
+	return resp
+}
+
+func (a *Account) setSession(resp *response) {
+	resp.header.Set(headerLSN, strconv.FormatInt(a.lsn, 10))
+	resp.header.Set(headerSessionToken, "0:-1#"+strconv.FormatInt(a.lsn, 10))
+}
+
+// checkIfMatch returns a 412 response if the If-Match precondition im does not
+// hold for it. An empty im always holds.
+func checkIfMatch(im string, it *item) *response {
+	if im != "" && im != "*" && im != it.etag() {
+		return errorResponse(http.StatusPreconditionFailed, "PreconditionFailed", "Operation cannot be performed because one of the specified precondition is not met.")
+	}
+	return nil
+}
+
+// scope returns the items a feed request covers, in creation order: one
+// logical partition if the request has a partition key and the whole
+// container otherwise.
+func (req *request) scope(c *container) ([]map[string]any, *response) {
+	pk, ok, err := req.partitionKey()
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	var items []*item
+	if ok {
+		items = slices.Collect(maps.Values(c.items[pk]))
+	} else {
+		for _, partition := range c.items {
+			items = slices.AppendSeq(items, maps.Values(partition))
+		}
+	}
+	slices.SortFunc(items, func(a, b *item) int { return cmp.Compare(a.seq, b.seq) })
+	docs := make([]map[string]any, len(items))
+	for i, it := range items {
+		docs[i] = it.body
+	}
+	return docs, nil
+}
+
+func (a *Account) readItems(req *request, c *container) *response {
+	docs, resp := req.scope(c)
+	if resp != nil {
+		return resp
+	}
+	results := make([]any, len(docs))
+	for i, doc := range docs {
+		results[i] = doc
+	}
+	resp, page := a.page(req, ridString(c.rid), "Documents", results)
+	return resp.setCharge(chargeQueryBase + chargeQueryPerKB*kilobytes(page))
+}
+
+func (a *Account) queryItems(req *request, c *container) *response {
+	_, single, _ := req.partitionKey()
+	if !single && !strings.EqualFold(req.header.Get(headerEnableCrossPart), "true") {
+		return badRequest("Cross partition query is required but disabled. Please set x-ms-documentdb-query-enablecrosspartition to true, specify x-ms-documentdb-partitionkey, or revise your query to avoid this exception.")
+	}
+	docs, resp := req.scope(c)
+	if resp != nil {
+		return resp
+	}
+	q, err := parseQueryRequest(req.body)
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	resp, page := a.page(req, ridString(c.rid), "Documents", q.run(docs))
+	first := req.header.Get(headerContinuation) == ""
+	return resp.setCharge(queryCharge(q, len(docs), page, first, !single))
+}
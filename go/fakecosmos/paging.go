@@ -0,0 +1,62 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// defaultMaxItemCount is the page size used when a request does not set
+// x-ms-max-item-count, or sets it to -1.
+const defaultMaxItemCount = 100
+
+// continuation is the state encoded in a continuation token. Feeds are
+// evaluated in full for every page, so a token is the offset of the next page
+// in the results and stays valid as long as the results do not change.
+type continuation struct {
+	Offset int `json:"offset"`
+	// Empty is set on the token of an injected empty page.
+	Empty bool `json:"empty,omitempty"`
+}
+
+// page returns the page of results a feed request asks for, with the
+// continuation token of the next page if there is one, and the results in the
+// page.
+func (a *Account) page(req *request, rid, kind string, results []any) (*response, []any) {
+	tok := continuation{}
+	if t := req.header.Get(headerContinuation); t != "" {
+		if err := json.Unmarshal([]byte(t), &tok); err != nil || tok.Offset < 0 {
+			return badRequest("Invalid Continuation Token %s", t), nil
+		}
+	}
+	maxItems := req.maxItemCount()
+
+	start := min(tok.Offset, len(results))
+	var next *continuation
+	if a.emptyPages && !tok.Empty && start < len(results) {
+		// Return nothing but the promise of more, as the service does
+		// when a partition it scanned had no matches.
+		results, next = nil, &continuation{Offset: start, Empty: true}
+	} else {
+		end := min(start+maxItems, len(results))
+		if end < len(results) {
+			next = &continuation{Offset: end}
+		}
+		results = results[start:end]
+	}
+
+	resp := feedResponse(rid, kind, results)
+	if next != nil {
+		b, _ := json.Marshal(next)
+		resp.header.Set(headerContinuation, string(b))
+	}
+	return resp, results
+}
+
+// maxItemCount returns the page size a feed request asks for.
+func (req *request) maxItemCount() int {
+	n, err := strconv.Atoi(req.header.Get(headerMaxItemCount))
+	if err != nil || n <= 0 {
+		return defaultMaxItemCount
+	}
+	return n
+}
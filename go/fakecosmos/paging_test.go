@@ -0,0 +1,122 @@
+package fakecosmos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// newTestContainer starts a server for an account configured by o and
+// returns an SDK client of its container test/items, partitioned on /pk.
+func newTestContainer(t *testing.T, o *Options, clientOptions *azcosmos.ClientOptions) (*azcosmos.ContainerClient, *Server) {
+	t.Helper()
+	srv := NewServer(o)
+	t.Cleanup(srv.Close)
+	if err := srv.Account.CreateContainer("test", "items", "/pk"); err != nil {
+		t.Fatal(err)
+	}
+	container, err := srv.ContainerClient("test", "items", clientOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return container, srv
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// writeItems upserts the items with the given ids into the partition pk.
+func writeItems(ctx context.Context, t *testing.T, c *azcosmos.ContainerClient, pk string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		item, _ := json.Marshal(map[string]any{"id": id, "pk": pk})
+		if _, err := c.UpsertItem(ctx, azcosmos.NewPartitionKeyString(pk), item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyPages(t *testing.T) {
+	ctx := testContext(t)
+	c, _ := newTestContainer(t, &Options{EmptyPages: true}, nil)
+	var want []string
+	for i := range 5 {
+		want = append(want, fmt.Sprintf("item%d", i))
+	}
+	writeItems(ctx, t, c, "p", want...)
+
+	pager := c.NewQueryItemsPager("SELECT VALUE c.id FROM c ORDER BY c.id", azcosmos.NewPartitionKeyString("p"), &azcosmos.QueryOptions{PageSizeHint: 2})
+	var ids []string
+	var sizes []int
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) == 0 && page.ContinuationToken == nil {
+			t.Errorf("page %d is empty and has no continuation", len(sizes)+1)
+		}
+		sizes = append(sizes, len(page.Items))
+		for _, item := range page.Items {
+			var id string
+			json.Unmarshal(item, &id)
+			ids = append(ids, id)
+		}
+	}
+	if !slices.Equal(ids, want) {
+		t.Errorf("ids = %q, want %q", ids, want)
+	}
+	// Every page of results is preceded by an empty one.
+	if want := []int{0, 2, 0, 2, 0, 1}; !slices.Equal(sizes, want) {
+		t.Errorf("page sizes = %v, want %v", sizes, want)
+	}
+
+	// A query with no results still ends without an empty page.
+	pager = c.NewQueryItemsPager("SELECT * FROM c", azcosmos.NewPartitionKeyString("none"), nil)
+	pages := 0
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pages++; len(page.Items) != 0 || page.ContinuationToken != nil {
+			t.Errorf("query of an empty partition returned %d items and continuation %v", len(page.Items), page.ContinuationToken)
+		}
+	}
+	if pages != 1 {
+		t.Errorf("query of an empty partition took %d pages, want 1", pages)
+	}
+}
+
+func TestMalformedContinuation(t *testing.T) {
+	ctx := testContext(t)
+	c, _ := newTestContainer(t, nil, nil)
+	writeItems(ctx, t, c, "p", "a", "b")
+	for _, token := range []string{"not a token", `{"offset":-1}`, `{"offset":"1"}`} {
+		o := &azcosmos.QueryOptions{ContinuationToken: to.Ptr(token)}
+		_, err := c.NewQueryItemsPager("SELECT * FROM c", azcosmos.NewPartitionKeyString("p"), o).NextPage(ctx)
+		var respErr *azcore.ResponseError
+		if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("continuation %q: error = %v, want 400", token, err)
+		}
+	}
+
+	// A valid token resumes where it says.
+	o := &azcosmos.QueryOptions{ContinuationToken: to.Ptr(`{"offset":1}`)}
+	page, err := c.NewQueryItemsPager("SELECT VALUE c.id FROM c ORDER BY c.id", azcosmos.NewPartitionKeyString("p"), o).NextPage(ctx)
+	if err != nil || len(page.Items) != 1 || string(page.Items[0]) != `"b"` {
+		t.Errorf("resuming at offset 1 = %q, %v; want [\"b\"]", page.Items, err)
+	}
+}
@@ -0,0 +1,255 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPatchOperations is the most operations a patch may have.
+const maxPatchOperations = 10
+
+// patchSpec is the body of a patch: JSON Patch style operations and an
+// optional SQL condition, such as "FROM c WHERE c.n > 1".
+type patchSpec struct {
+	Condition  string           `json:"condition"`
+	Operations []patchOperation `json:"operations"`
+}
+
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+	// From is the path a move takes its value from.
+	From string `json:"from"`
+}
+
+// patchItem serves a PATCH of an existing item.
+func (a *Account) patchItem(req *request, db *database, c *container, pk string, existing *item) *response {
+	if resp := checkIfMatch(req.header.Get(headerIfMatch), existing); resp != nil {
+		return resp
+	}
+	doc, resp := c.patch(pk, existing.body, req.body)
+	if resp != nil {
+		return resp
+	}
+	it := a.newItem(db, c, doc, existing)
+	c.setItem(pk, it)
+	a.persist(itemRecord(db, c, pk, it))
+	resp = a.itemResponse(http.StatusOK, req, it).setCharge(chargeWritePerKB * kilobytes(it.body))
+	a.setSession(resp)
+	return resp
+}
+
+// patch returns a copy of doc, an item in the logical partition pk, with the
+// patch in body applied. Stored documents are never modified.
+func (c *container) patch(pk string, doc map[string]any, body []byte) (map[string]any, *response) {
+	spec := patchSpec{}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil, badRequest("The input content is invalid: %v", err)
+	}
+	if len(spec.Operations) == 0 || len(spec.Operations) > maxPatchOperations {
+		return nil, badRequest("Patch request must have between 1 and %d operations.", maxPatchOperations)
+	}
+	if spec.Condition != "" {
+		q, err := parseQuery("SELECT * "+spec.Condition, nil)
+		if err != nil {
+			return nil, badRequest("Invalid patch condition: %v", err)
+		}
+		if len(q.run([]map[string]any{doc})) == 0 {
+			return nil, errorResponse(http.StatusPreconditionFailed, "PreconditionFailed", "Precondition of the patch operation is not met.")
+		}
+	}
+
+	patched := deepCopy(doc).(map[string]any)
+	for i, op := range spec.Operations {
+		steps, err := parsePointer(op.Path)
+		if err == nil && op.Op == "move" {
+			err = move(patched, op, steps)
+		} else if err == nil {
+			_, err = applyPatch(patched, steps, op)
+		}
+		if err != nil {
+			return nil, badRequest("Patch operation %d (%s %s) failed: %v", i, op.Op, op.Path, err)
+		}
+	}
+	if patched["id"] != doc["id"] {
+		return nil, badRequest("Patch cannot change the id of an item.")
+	}
+	if c.partitionKey(patched) != pk {
+		return nil, badRequest("Patch cannot change the partition key of an item.")
+	}
+	return patched, nil
+}
+
+// parsePointer splits a JSON Pointer, such as /tags/0, into its unescaped
+// reference tokens.
+func parsePointer(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	steps := strings.Split(path[1:], "/")
+	for i, s := range steps {
+		steps[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(s)
+	}
+	return steps, nil
+}
+
+// move applies a move operation to doc: it removes the value at op.From and
+// adds it at steps, the path of op, as JSON Patch does. The value replaces a
+// member already at the path and is inserted before an array index.
+func move(doc map[string]any, op patchOperation, steps []string) error {
+	fromSteps, err := parsePointer(op.From)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	value, err := lookup(doc, fromSteps)
+	if err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	if op.Path == op.From {
+		return nil
+	}
+	if strings.HasPrefix(op.Path, op.From+"/") {
+		return fmt.Errorf("cannot move %s into itself", op.From)
+	}
+	if _, err := applyPatch(doc, fromSteps, patchOperation{Op: "remove"}); err != nil {
+		return err
+	}
+	_, err = applyPatch(doc, steps, patchOperation{Op: "add", Value: value})
+	return err
+}
+
+// lookup returns the value at steps below v.
+func lookup(v any, steps []string) (any, error) {
+	for _, step := range steps {
+		switch e := v.(type) {
+		case map[string]any:
+			child, ok := e[step]
+			if !ok {
+				return nil, errors.New("path does not exist")
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(e) {
+				return nil, fmt.Errorf("invalid array index %q", step)
+			}
+			v = e[i]
+		default:
+			return nil, errors.New("path does not exist")
+		}
+	}
+	return v, nil
+}
+
+// applyPatch applies op at steps below v and returns the new value of v,
+// which differs from v when an array grows or shrinks.
+func applyPatch(v any, steps []string, op patchOperation) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		key := steps[0]
+		old, exists := v[key]
+		if len(steps) > 1 {
+			if !exists {
+				return nil, errors.New("path does not exist")
+			}
+			child, err := applyPatch(old, steps[1:], op)
+			v[key] = child
+			return v, err
+		}
+		switch op.Op {
+		case "add", "set":
+			v[key] = op.Value
+		case "replace":
+			if !exists {
+				return nil, errors.New("path does not exist")
+			}
+			v[key] = op.Value
+		case "remove":
+			if !exists {
+				return nil, errors.New("path does not exist")
+			}
+			delete(v, key)
+		case "incr":
+			sum, err := increment(old, exists, op.Value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = sum
+		default:
+			return nil, fmt.Errorf("unknown operation %q", op.Op)
+		}
+		return v, nil
+
+	case []any:
+		if len(steps) == 1 && steps[0] == "-" && (op.Op == "add" || op.Op == "set") {
+			return append(v, op.Value), nil
+		}
+		i, err := strconv.Atoi(steps[0])
+		if err != nil || i < 0 || i > len(v) || i == len(v) && (len(steps) > 1 || op.Op != "add") {
+			return nil, fmt.Errorf("invalid array index %q", steps[0])
+		}
+		if len(steps) > 1 {
+			child, err := applyPatch(v[i], steps[1:], op)
+			v[i] = child
+			return v, err
+		}
+		switch op.Op {
+		case "add":
+			return append(v[:i], append([]any{op.Value}, v[i:]...)...), nil
+		case "set", "replace":
+			v[i] = op.Value
+		case "remove":
+			return append(v[:i], v[i+1:]...), nil
+		case "incr":
+			sum, err := increment(v[i], true, op.Value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = sum
+		default:
+			return nil, fmt.Errorf("unknown operation %q", op.Op)
+		}
+		return v, nil
+	}
+	return nil, errors.New("path does not exist")
+}
+
+// increment adds by to old, a missing value counting as zero.
+func increment(old any, exists bool, by any) (any, error) {
+	n, ok := by.(float64)
+	if !ok {
+		return nil, errors.New("increment value is not a number")
+	}
+	if !exists {
+		return n, nil
+	}
+	m, ok := old.(float64)
+	if !ok {
+		return nil, errors.New("target is not a number")
+	}
+	return m + n, nil
+}
+
+// deepCopy copies a decoded JSON value.
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i] = deepCopy(e)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+func TestPatch(t *testing.T) {
+	ctx := testContext(t)
+	c, _ := newTestContainer(t, nil, nil)
+	pk := azcosmos.NewPartitionKeyString("p")
+	original := `{"id": "a", "pk": "p", "n": 1, "tags": ["x", "y"], "owner": {"name": "kim"}, "old": true}`
+	reset := func() {
+		t.Helper()
+		if _, err := c.UpsertItem(ctx, pk, []byte(original), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// read returns the item without its system properties.
+	read := func() map[string]any {
+		t.Helper()
+		resp, err := c.ReadItem(ctx, pk, "a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		json.Unmarshal(resp.Value, &doc)
+		for _, p := range []string{"_rid", "_self", "_etag", "_attachments", "_ts"} {
+			delete(doc, p)
+		}
+		return doc
+	}
+	decode := func(s string) map[string]any {
+		var doc map[string]any
+		if err := json.Unmarshal([]byte(s), &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+
+	reset()
+	ops := azcosmos.PatchOperations{}
+	ops.AppendSet("/owner/name", "ada")
+	ops.AppendSet("/owner/since", 2020)
+	ops.AppendReplace("/n", 5)
+	ops.AppendIncrement("/n", 2)
+	ops.AppendIncrement("/count", 1)
+	ops.AppendRemove("/old")
+	ops.AppendAdd("/tags/-", "z")
+	ops.AppendAdd("/tags/1", "w")
+	ops.AppendAdd("/extra", map[string]any{"k": "v"})
+	if _, err := c.PatchItem(ctx, pk, "a", ops, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := decode(`{"id": "a", "pk": "p", "n": 7, "count": 1, "tags": ["x", "w", "y", "z"], "owner": {"name": "ada", "since": 2020}, "extra": {"k": "v"}}`)
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Errorf("patched item = %v, want %v", got, want)
+	}
+
+	failures := []struct {
+		name   string
+		ops    func(*azcosmos.PatchOperations)
+		cond   string
+		status int
+	}{
+		{"replace of a missing path", func(o *azcosmos.PatchOperations) { o.AppendReplace("/missing", 1) }, "", http.StatusBadRequest},
+		{"remove of a missing path", func(o *azcosmos.PatchOperations) { o.AppendRemove("/missing") }, "", http.StatusBadRequest},
+		{"set below a missing path", func(o *azcosmos.PatchOperations) { o.AppendSet("/missing/name", 1) }, "", http.StatusBadRequest},
+		{"index past the end", func(o *azcosmos.PatchOperations) { o.AppendReplace("/tags/5", "v") }, "", http.StatusBadRequest},
+		{"increment of a string", func(o *azcosmos.PatchOperations) { o.AppendIncrement("/owner/name", 1) }, "", http.StatusBadRequest},
+		{"changing the id", func(o *azcosmos.PatchOperations) { o.AppendSet("/id", "b") }, "", http.StatusBadRequest},
+		{"changing the partition key", func(o *azcosmos.PatchOperations) { o.AppendSet("/pk", "q") }, "", http.StatusBadRequest},
+		{"removing the partition key", func(o *azcosmos.PatchOperations) { o.AppendRemove("/pk") }, "", http.StatusBadRequest},
+		{"failing condition", func(o *azcosmos.PatchOperations) { o.AppendSet("/n", 0) }, "FROM c WHERE c.n > 100", http.StatusPreconditionFailed},
+		{"invalid condition", func(o *azcosmos.PatchOperations) { o.AppendSet("/n", 0) }, "FROM c WHERE", http.StatusBadRequest},
+	}
+	for _, tt := range failures {
+		reset()
+		ops := azcosmos.PatchOperations{}
+		tt.ops(&ops)
+		if tt.cond != "" {
+			ops.SetCondition(tt.cond)
+		}
+		// A later operation that would succeed is not applied either.
+		ops.AppendSet("/touched", true)
+		if _, err := c.PatchItem(ctx, pk, "a", ops, nil); statusOf(err) != tt.status {
+			t.Errorf("%s: error = %v, want %d", tt.name, err, tt.status)
+		}
+		if got := read(); !reflect.DeepEqual(got, decode(original)) {
+			t.Errorf("%s: failed patch changed the item to %v", tt.name, got)
+		}
+	}
+
+	// A condition on the system properties holds for a freshly written
+	// item.
+	reset()
+	ops = azcosmos.PatchOperations{}
+	ops.SetCondition("FROM c WHERE c._ts > 0 AND c.n = 1")
+	ops.AppendIncrement("/n", 1)
+	if _, err := c.PatchItem(ctx, pk, "a", ops, nil); err != nil {
+		t.Errorf("patch with a condition that holds: %v", err)
+	}
+
+	ops = azcosmos.PatchOperations{}
+	ops.AppendSet("/n", 1)
+	if _, err := c.PatchItem(ctx, pk, "missing", ops, nil); statusOf(err) != http.StatusNotFound {
+		t.Errorf("patch of a missing item: error = %v, want 404", err)
+	}
+}
+
+// TestPatchMove applies move operations directly, as the SDK has no method
+// to append one.
+func TestPatchMove(t *testing.T) {
+	a := NewAccount(nil)
+	if err := a.CreateContainer("test", "items", "/pk"); err != nil {
+		t.Fatal(err)
+	}
+	c := a.databases["test"].containers["items"]
+	var doc map[string]any
+	original := `{"id": "a", "pk": "p", "n": 1, "tags": ["x", "y", "z"], "owner": {"name": "kim"}}`
+	if err := json.Unmarshal([]byte(original), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ops  string
+		// want is the patched item, or empty if the patch fails with 400.
+		want string
+	}{
+		{"rename", `{"op": "move", "from": "/n", "path": "/count"}`,
+			`{"id": "a", "pk": "p", "count": 1, "tags": ["x", "y", "z"], "owner": {"name": "kim"}}`},
+		{"replaces the target", `{"op": "move", "from": "/n", "path": "/owner"}`,
+			`{"id": "a", "pk": "p", "owner": 1, "tags": ["x", "y", "z"]}`},
+		{"into an object", `{"op": "move", "from": "/n", "path": "/owner/n"}`,
+			`{"id": "a", "pk": "p", "tags": ["x", "y", "z"], "owner": {"name": "kim", "n": 1}}`},
+		{"out of an array", `{"op": "move", "from": "/tags/0", "path": "/first"}`,
+			`{"id": "a", "pk": "p", "n": 1, "first": "x", "tags": ["y", "z"], "owner": {"name": "kim"}}`},
+		{"within an array", `{"op": "move", "from": "/tags/0", "path": "/tags/-"}`,
+			`{"id": "a", "pk": "p", "n": 1, "tags": ["y", "z", "x"], "owner": {"name": "kim"}}`},
+		{"onto itself", `{"op": "move", "from": "/owner", "path": "/owner"}`, original},
+		{"then set", `{"op": "move", "from": "/n", "path": "/m"}, {"op": "set", "path": "/n", "value": 2}`,
+			`{"id": "a", "pk": "p", "n": 2, "m": 1, "tags": ["x", "y", "z"], "owner": {"name": "kim"}}`},
+		{"missing from", `{"op": "move", "from": "/missing", "path": "/n"}`, ""},
+		{"no from", `{"op": "move", "path": "/n"}`, ""},
+		{"into itself", `{"op": "move", "from": "/owner", "path": "/owner/self"}`, ""},
+		{"past the end of an array", `{"op": "move", "from": "/n", "path": "/tags/4"}`, ""},
+		{"the partition key", `{"op": "move", "from": "/pk", "path": "/old_pk"}`, ""},
+		{"the id", `{"op": "move", "from": "/n", "path": "/id"}`, ""},
+	}
+	for _, tt := range tests {
+		got, resp := c.patch(c.partitionKey(doc), doc, []byte(`{"operations": [`+tt.ops+`]}`))
+		if tt.want == "" {
+			if resp == nil || resp.status != http.StatusBadRequest {
+				t.Errorf("%s: patch succeeded with %v, want 400", tt.name, got)
+			}
+			continue
+		}
+		if resp != nil {
+			t.Errorf("%s: patch failed with %d: %v", tt.name, resp.status, resp.body)
+			continue
+		}
+		var want map[string]any
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: patched item = %v, want %v", tt.name, got, want)
+		}
+	}
+	// The stored document is never modified.
+	var want map[string]any
+	json.Unmarshal([]byte(original), &want)
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("patches changed the original to %v", doc)
+	}
+}
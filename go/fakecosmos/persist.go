@@ -0,0 +1,287 @@
+package fakecosmos
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+)
+
+// minCompactRecords is the smallest log that is compacted. A log is compacted
+// once it holds twice as many records as it did after the last compaction.
+const minCompactRecords = 1000
+
+// Log record operations.
+const (
+	opDatabase        = "database"
+	opDeleteDatabase  = "delete_database"
+	opContainer       = "container"
+	opDeleteContainer = "delete_container"
+	opItem            = "item"
+	opDeleteItem      = "delete_item"
+)
+
+// logRecord is one change in the append-only log of a file-backed account.
+// Databases, containers and items are logged whole, so replaying the latest
+// record of each restores it.
+type logRecord struct {
+	Op        string `json:"op"`
+	Database  string `json:"db"`
+	Container string `json:"coll,omitempty"`
+	// NextRID and LSN are the account's counters after the change.
+	NextRID uint32 `json:"next_rid"`
+	LSN     int64  `json:"lsn"`
+
+	// Databases and containers.
+	RID               []byte          `json:"rid,omitempty"`
+	ETag              string          `json:"etag,omitempty"`
+	TS                int64           `json:"ts,omitempty"`
+	PartitionKeyPaths []string        `json:"pk_paths,omitempty"`
+	DefaultTTL        *int            `json:"default_ttl,omitempty"`
+	IndexingPolicy    json.RawMessage `json:"indexing_policy,omitempty"`
+	Throughput        float64         `json:"throughput,omitempty"`
+
+	// Items.
+	PartitionKey string         `json:"pk,omitempty"`
+	ID           string         `json:"id,omitempty"`
+	Seq          uint64         `json:"seq,omitempty"`
+	ItemLSN      int64          `json:"item_lsn,omitempty"`
+	Doc          map[string]any `json:"doc,omitempty"`
+}
+
+// Open returns an account kept in the file at path, loading what an earlier
+// run left there. Every change is appended to the file, which is compacted
+// when it grows, so only one account may use a file at a time. o may be nil.
+// Close the account when done.
+func Open(path string, o *Options) (*Account, error) {
+	a := NewAccount(o)
+	a.path = path
+	if err := a.load(); err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	// Compacting drops records that were overwritten or torn by a crash.
+	if err := a.compact(); err != nil {
+		return nil, fmt.Errorf("compact %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Close closes the file of a file-backed account. It reports the first error
+// writing to it, if any.
+func (a *Account) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.log == nil {
+		return a.logErr
+	}
+	err := a.log.Close()
+	a.log = nil
+	return cmp.Or(a.logErr, err)
+}
+
+func (a *Account) load() error {
+	f, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// An unterminated last record was torn by a crash while
+			// being written.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rec := logRecord{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		if err := a.apply(&rec); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+}
+
+// apply replays a log record.
+func (a *Account) apply(rec *logRecord) error {
+	a.nextRID = max(a.nextRID, rec.NextRID)
+	a.lsn = max(a.lsn, rec.LSN)
+	if rec.Op == opDatabase {
+		if db, ok := a.databases[rec.Database]; ok {
+			db.rid, db.etag, db.ts = rec.RID, rec.ETag, rec.TS
+			return nil
+		}
+		a.databases[rec.Database] = &database{
+			id:         rec.Database,
+			rid:        rec.RID,
+			etag:       rec.ETag,
+			ts:         rec.TS,
+			containers: map[string]*container{},
+		}
+		return nil
+	}
+	db, ok := a.databases[rec.Database]
+	if !ok {
+		return fmt.Errorf("database %s does not exist", rec.Database)
+	}
+	if rec.Op == opDeleteDatabase {
+		delete(a.databases, rec.Database)
+		return nil
+	}
+	if rec.Op == opContainer {
+		c, ok := db.containers[rec.Container]
+		if !ok {
+			c = &container{id: rec.Container, items: map[string]map[string]*item{}}
+			db.containers[rec.Container] = c
+		}
+		c.rid, c.etag, c.ts = rec.RID, rec.ETag, rec.TS
+		c.partitionKeyPaths = rec.PartitionKeyPaths
+		c.defaultTTL, c.indexingPolicy = rec.DefaultTTL, rec.IndexingPolicy
+		c.nextExpiry = 0
+		c.budget.setThroughput(rec.Throughput, a.now())
+		return nil
+	}
+	c, ok := db.containers[rec.Container]
+	if !ok {
+		return fmt.Errorf("container %s does not exist in database %s", rec.Container, rec.Database)
+	}
+	switch rec.Op {
+	case opDeleteContainer:
+		delete(db.containers, rec.Container)
+	case opItem:
+		c.nextDocRID = max(c.nextDocRID, rec.Seq)
+		c.setItem(rec.PartitionKey, &item{seq: rec.Seq, lsn: rec.ItemLSN, body: rec.Doc})
+	case opDeleteItem:
+		c.deleteItem(rec.PartitionKey, rec.ID)
+	default:
+		return fmt.Errorf("unknown operation %q", rec.Op)
+	}
+	return nil
+}
+
+// persist appends records to the log of a file-backed account in a single
+// write, so the changes of a batch land together. A failed write is kept in
+// a.logErr and fails every later request, so the account never silently
+// diverges from its file.
+func (a *Account) persist(recs ...*logRecord) {
+	if a.log == nil || a.logErr != nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, rec := range recs {
+		rec.NextRID, rec.LSN = a.nextRID, a.lsn
+		line, _ := json.Marshal(rec)
+		buf.Write(append(line, '\n'))
+	}
+	if _, err := a.log.Write(buf.Bytes()); err != nil {
+		a.logErr = fmt.Errorf("write %s: %w", a.path, err)
+		return
+	}
+	a.logRecords += len(recs)
+	if a.logRecords >= 2*max(a.compactedRecords, minCompactRecords) {
+		if err := a.compact(); err != nil {
+			a.logErr = fmt.Errorf("compact %s: %w", a.path, err)
+		}
+	}
+}
+
+func databaseRecord(db *database) *logRecord {
+	return &logRecord{Op: opDatabase, Database: db.id, RID: db.rid, ETag: db.etag, TS: db.ts}
+}
+
+func containerRecord(db *database, c *container) *logRecord {
+	return &logRecord{
+		Op:                opContainer,
+		Database:          db.id,
+		Container:         c.id,
+		RID:               c.rid,
+		ETag:              c.etag,
+		TS:                c.ts,
+		PartitionKeyPaths: c.partitionKeyPaths,
+		DefaultTTL:        c.defaultTTL,
+		IndexingPolicy:    c.indexingPolicy,
+		Throughput:        c.budget.throughput,
+	}
+}
+
+func itemRecord(db *database, c *container, pk string, it *item) *logRecord {
+	return &logRecord{Op: opItem, Database: db.id, Container: c.id, PartitionKey: pk, Seq: it.seq, ItemLSN: it.lsn, Doc: it.body}
+}
+
+// compact rewrites the log with one record per database, container and item,
+// replacing the file atomically.
+func (a *Account) compact() error {
+	if a.log != nil {
+		if err := a.log.Close(); err != nil {
+			return err
+		}
+		a.log = nil
+	}
+	var buf bytes.Buffer
+	records := 0
+	write := func(rec *logRecord) {
+		rec.NextRID, rec.LSN = a.nextRID, a.lsn
+		line, _ := json.Marshal(rec)
+		buf.Write(append(line, '\n'))
+		records++
+	}
+	for _, dbID := range slices.Sorted(maps.Keys(a.databases)) {
+		db := a.databases[dbID]
+		write(databaseRecord(db))
+		for _, cID := range slices.Sorted(maps.Keys(db.containers)) {
+			c := db.containers[cID]
+			write(containerRecord(db, c))
+			// Items are written in LSN order, which rebuilds the change log
+			// when the file is loaded.
+			for _, ch := range c.changes {
+				if it := c.current(ch); it != nil {
+					write(itemRecord(db, c, ch.pk, it))
+				}
+			}
+		}
+	}
+
+	tmp := a.path + ".tmp"
+	if err := writeFileSync(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	a.log = f
+	a.logRecords, a.compactedRecords = records, records
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
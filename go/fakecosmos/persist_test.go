@@ -0,0 +1,253 @@
+package fakecosmos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// openTestAccount opens the account kept at path with the clock now and
+// returns an SDK client of its container test/items, which it creates with
+// time to live enabled if it does not exist yet.
+func openTestAccount(t *testing.T, path string, now func() time.Time) (*Account, *azcosmos.ContainerClient) {
+	t.Helper()
+	a, err := Open(path, &Options{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Server: httptest.NewServer(a), Account: a}
+	t.Cleanup(srv.Close)
+	client, err := srv.Client(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+	if _, err := client.CreateDatabase(ctx, azcosmos.DatabaseProperties{ID: "test"}, nil); err != nil && !isConflict(err) {
+		t.Fatal(err)
+	}
+	db, err := client.NewDatabase("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateContainer(ctx, azcosmos.ContainerProperties{
+		ID:                     "items",
+		PartitionKeyDefinition: azcosmos.PartitionKeyDefinition{Paths: []string{"/pk"}},
+		DefaultTimeToLive:      to.Ptr[int32](-1),
+	}, nil)
+	if err != nil && !isConflict(err) {
+		t.Fatal(err)
+	}
+	c, err := db.NewContainer("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, c
+}
+
+// statusOf returns the HTTP status of a failed request, or 0.
+func statusOf(err error) int {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode
+	}
+	return 0
+}
+
+func isConflict(err error) bool { return statusOf(err) == http.StatusConflict }
+
+func isNotFound(err error) bool { return statusOf(err) == http.StatusNotFound }
+
+// snapshot encodes the state of a: its counters, resources, items and the
+// order of the change log.
+func snapshot(t *testing.T, a *Account) string {
+	t.Helper()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	databases := map[string]any{}
+	for id, db := range a.databases {
+		containers := map[string]any{}
+		for cid, c := range db.containers {
+			items := map[string]any{}
+			for pk, partition := range c.items {
+				for id, it := range partition {
+					items[pk+"/"+id] = map[string]any{"seq": it.seq, "lsn": it.lsn, "body": it.body}
+				}
+			}
+			var changes []string
+			for _, ch := range c.changes {
+				if c.current(ch) != nil {
+					changes = append(changes, fmt.Sprintf("%d %s/%s", ch.lsn, ch.pk, ch.id))
+				}
+			}
+			containers[cid] = map[string]any{
+				"rid": c.rid, "etag": c.etag, "ts": c.ts, "pk": c.partitionKeyPaths, "ttl": c.defaultTTL,
+				"next_doc_rid": c.nextDocRID, "items": items, "changes": changes,
+			}
+		}
+		databases[id] = map[string]any{"rid": db.rid, "etag": db.etag, "ts": db.ts, "containers": containers}
+	}
+	b, err := json.Marshal(map[string]any{"next_rid": a.nextRID, "lsn": a.lsn, "databases": databases})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "account.jsonl")
+	var offset atomic.Int64
+	now := func() time.Time { return time.Now().Add(time.Duration(offset.Load())) }
+	ctx := testContext(t)
+	a, c := openTestAccount(t, path, now)
+	pk := azcosmos.NewPartitionKeyString("p")
+
+	writeItems(ctx, t, c, "p", "kept", "deleted", "updated")
+	writeItems(ctx, t, c, "p", "updated")
+	if _, err := c.DeleteItem(ctx, pk, "deleted", nil); err != nil {
+		t.Fatal(err)
+	}
+	short, _ := json.Marshal(map[string]any{"id": "expired", "pk": "p", "ttl": 1})
+	if _, err := c.UpsertItem(ctx, pk, short, nil); err != nil {
+		t.Fatal(err)
+	}
+	offset.Add(int64(2 * time.Second))
+	if _, err := c.ReadItem(ctx, pk, "expired", nil); !isNotFound(err) {
+		t.Fatalf("read of an expired item: error = %v, want 404", err)
+	}
+	before := snapshot(t, a)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, c = openTestAccount(t, path, now)
+	defer a.Close()
+	if after := snapshot(t, a); after != before {
+		t.Errorf("state after restart:\n%s\nwant:\n%s", after, before)
+	}
+	for id, want := range map[string]bool{"kept": true, "updated": true, "deleted": false, "expired": false} {
+		_, err := c.ReadItem(ctx, pk, id, nil)
+		if found := err == nil; found != want || err != nil && !isNotFound(err) {
+			t.Errorf("ReadItem(%s) after restart: error = %v, want found %v", id, err, want)
+		}
+	}
+	// Counters carry on where they left off, so a new item gets a new rid.
+	resp, err := c.UpsertItem(ctx, pk, []byte(`{"id": "new", "pk": "p"}`), &azcosmos.ItemOptions{EnableContentResponseOnWrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		RID string `json:"_rid"`
+	}
+	json.Unmarshal(resp.Value, &doc)
+	if doc.RID == "" || strings.Contains(before, doc.RID) {
+		t.Errorf("item written after the restart has rid %q, which was already in use", doc.RID)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "account.jsonl")
+	ctx := testContext(t)
+	a, c := openTestAccount(t, path, nil)
+	pk := azcosmos.NewPartitionKeyString("p")
+	for i := range 50 {
+		writeItems(ctx, t, c, "p", fmt.Sprintf("item%d", i%10))
+	}
+	if _, err := c.DeleteItem(ctx, pk, "item3", nil); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t, a)
+
+	a.mu.Lock()
+	err := a.compact()
+	a.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One record for the database, the container and each of the nine
+	// items left.
+	if n := countLines(t, path); n != 11 {
+		t.Errorf("compacted log has %d records, want 11", n)
+	}
+	if after := snapshot(t, a); after != before {
+		t.Errorf("state after compaction:\n%s\nwant:\n%s", after, before)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ = openTestAccount(t, path, nil)
+	defer a.Close()
+	if after := snapshot(t, a); after != before {
+		t.Errorf("state loaded from the compacted log:\n%s\nwant:\n%s", after, before)
+	}
+}
+
+func TestTruncatedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "account.jsonl")
+	ctx := testContext(t)
+	a, c := openTestAccount(t, path, nil)
+	writeItems(ctx, t, c, "p", "a", "b")
+	before := snapshot(t, a)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash while appending leaves part of a record without its newline.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"op":"item","db":"test","coll":"items","pk":"[\"p\"]","id":"c","doc":{"id":"c",`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	a, err = Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open with a torn last record: %v", err)
+	}
+	if after := snapshot(t, a); after != before {
+		t.Errorf("state after loading a torn log:\n%s\nwant:\n%s", after, before)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Opening compacted the torn record away.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		t.Errorf("log still ends in a torn record: %q", data[max(0, len(data)-40):])
+	}
+
+	// A corrupt record that is not the last is an error, not data loss.
+	if err := os.WriteFile(path, append([]byte("{\"op\":\n"), data...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, nil); err == nil {
+		t.Error("Open with a corrupt first record succeeded")
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
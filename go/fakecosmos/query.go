@@ -0,0 +1,978 @@
+package fakecosmos
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// querySpec is the body of a query request.
+type querySpec struct {
+	Query      string `json:"query"`
+	Parameters []struct {
+		Name  string `json:"name"`
+		Value any    `json:"value"`
+	} `json:"parameters"`
+}
+
+// parseQueryRequest parses a query request body and binds its parameters.
+func parseQueryRequest(body []byte) (*query, error) {
+	spec := querySpec{}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil, fmt.Errorf("invalid query request: %w", err)
+	}
+	params := map[string]any{}
+	for _, p := range spec.Parameters {
+		params[p.Name] = p.Value
+	}
+	return parseQuery(spec.Query, params)
+}
+
+// query is a parsed query in the subset of the Cosmos DB SQL grammar the fake
+// supports:
+//
+//	SELECT [DISTINCT] [TOP n] (* | VALUE expr | expr [AS name], ...)
+//	FROM container [[AS] alias]
+//	[WHERE expr]
+//	[ORDER BY expr [ASC | DESC], ...]
+//	[OFFSET n LIMIT m]
+//
+// Expressions are property paths, literals, parameters, the comparison
+// operators =, !=, <>, <, <=, > and >=, AND, OR, NOT, IN, and the functions
+// STARTSWITH, IS_DEFINED and COUNT. Parameters are bound when parsing.
+type query struct {
+	distinct bool
+	top      int // -1 without TOP
+	star     bool
+	value    expr // SELECT VALUE expr
+	items    []selectItem
+	where    expr
+	orderBy  []orderItem
+	offset   int
+	limit    int // -1 without LIMIT
+}
+
+type selectItem struct {
+	name string
+	expr expr
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+// expr is a query expression evaluated against a document. ok is false for
+// undefined results, such as missing properties or comparisons of values of
+// different types.
+type expr interface {
+	eval(doc map[string]any) (v any, ok bool)
+}
+
+type literal struct{ v any }
+
+func (l literal) eval(map[string]any) (any, bool) { return l.v, true }
+
+// undefinedLiteral is the literal undefined.
+type undefinedLiteral struct{}
+
+func (undefinedLiteral) eval(map[string]any) (any, bool) { return nil, false }
+
+// path is a property path from the document root. Each step is a property
+// name or an array index.
+type path struct{ steps []any }
+
+func (p path) eval(doc map[string]any) (any, bool) {
+	var v any = doc
+	for _, step := range p.steps {
+		switch step := step.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[step]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]any)
+			if !ok || step >= len(a) {
+				return nil, false
+			}
+			v = a[step]
+		}
+	}
+	return v, true
+}
+
+type not struct{ x expr }
+
+func (n not) eval(doc map[string]any) (any, bool) {
+	if b, ok := asBool(n.x.eval(doc)); ok {
+		return !b, true
+	}
+	return nil, false
+}
+
+type logical struct {
+	and         bool
+	left, right expr
+}
+
+// eval implements three-valued logic: an undefined operand only makes the
+// result undefined if the other operand does not decide it.
+func (l logical) eval(doc map[string]any) (any, bool) {
+	lb, lok := asBool(l.left.eval(doc))
+	rb, rok := asBool(l.right.eval(doc))
+	switch {
+	case l.and && (lok && !lb || rok && !rb):
+		return false, true
+	case !l.and && (lok && lb || rok && rb):
+		return true, true
+	case lok && rok:
+		return l.and, true
+	}
+	return nil, false
+}
+
+// asBool returns the boolean result of an evaluation. Other types count as
+// undefined.
+func asBool(v any, ok bool) (b, isBool bool) {
+	b, isBool = v.(bool)
+	return b, ok && isBool
+}
+
+type comparison struct {
+	op          string
+	left, right expr
+}
+
+// eval compares values of the same type. Comparing different types, or
+// ordering arrays and objects, is undefined.
+func (c comparison) eval(doc map[string]any) (any, bool) {
+	l, lok := c.left.eval(doc)
+	r, rok := c.right.eval(doc)
+	if !lok || !rok || typeRank(l) != typeRank(r) {
+		return nil, false
+	}
+	switch c.op {
+	case "=":
+		return reflect.DeepEqual(l, r), true
+	case "!=", "<>":
+		return !reflect.DeepEqual(l, r), true
+	}
+	switch l.(type) {
+	case []any, map[string]any:
+		return nil, false
+	}
+	n := compare(l, r)
+	switch c.op {
+	case "<":
+		return n < 0, true
+	case "<=":
+		return n <= 0, true
+	case ">":
+		return n > 0, true
+	default:
+		return n >= 0, true
+	}
+}
+
+type in struct {
+	x    expr
+	list []expr
+}
+
+func (e in) eval(doc map[string]any) (any, bool) {
+	v, ok := e.x.eval(doc)
+	if !ok {
+		return nil, false
+	}
+	for _, item := range e.list {
+		if w, ok := item.eval(doc); ok && reflect.DeepEqual(v, w) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+type startsWith struct {
+	s, prefix, ignoreCase expr
+}
+
+func (f startsWith) eval(doc map[string]any) (any, bool) {
+	s, sok := f.s.eval(doc)
+	prefix, pok := f.prefix.eval(doc)
+	str, isStr := s.(string)
+	pre, isPre := prefix.(string)
+	if !sok || !pok || !isStr || !isPre {
+		return nil, false
+	}
+	if f.ignoreCase != nil {
+		if ignore, ok := asBool(f.ignoreCase.eval(doc)); ok && ignore {
+			str, pre = strings.ToLower(str), strings.ToLower(pre)
+		}
+	}
+	return strings.HasPrefix(str, pre), true
+}
+
+type isDefined struct{ x expr }
+
+func (f isDefined) eval(doc map[string]any) (any, bool) {
+	_, ok := f.x.eval(doc)
+	return ok, true
+}
+
+// count is the COUNT aggregate. It is only valid as a whole select item and
+// is computed over all matching documents by run rather than by eval.
+type count struct{ x expr }
+
+func (count) eval(map[string]any) (any, bool) { return nil, false }
+
+// typeRank orders JSON types the way Cosmos DB orders mixed-type values.
+func typeRank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 1
+	case bool:
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	case map[string]any:
+		return 6
+	}
+	return 7
+}
+
+// compare orders two values of the same scalar type.
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case bool:
+		return cmp.Compare(boolInt(a), boolInt(b.(bool)))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compareForOrder orders any two results, undefined ones first and then by
+// type.
+func compareForOrder(a any, aok bool, b any, bok bool) int {
+	switch {
+	case !aok || !bok:
+		return cmp.Compare(boolInt(aok), boolInt(bok))
+	case typeRank(a) != typeRank(b):
+		return cmp.Compare(typeRank(a), typeRank(b))
+	}
+	return compare(a, b)
+}
+
+// run evaluates the query against docs.
+func (q *query) run(docs []map[string]any) []any {
+	var matched []map[string]any
+	for _, doc := range docs {
+		if q.where != nil {
+			if b, ok := asBool(q.where.eval(doc)); !ok || !b {
+				continue
+			}
+		}
+		matched = append(matched, doc)
+	}
+
+	if len(q.orderBy) > 0 {
+		slices.SortStableFunc(matched, func(a, b map[string]any) int {
+			for _, o := range q.orderBy {
+				av, aok := o.expr.eval(a)
+				bv, bok := o.expr.eval(b)
+				n := compareForOrder(av, aok, bv, bok)
+				if o.desc {
+					n = -n
+				}
+				if n != 0 {
+					return n
+				}
+			}
+			return 0
+		})
+	}
+
+	results := []any{}
+	if q.aggregate() {
+		if v, ok := q.project(nil, matched); ok {
+			results = append(results, v)
+		}
+	} else {
+		for _, doc := range matched {
+			if v, ok := q.project(doc, nil); ok {
+				results = append(results, v)
+			}
+		}
+	}
+
+	if q.distinct {
+		seen := map[string]bool{}
+		results = slices.DeleteFunc(results, func(v any) bool {
+			// Maps marshal with sorted keys, so equal values encode equally.
+			b, _ := json.Marshal(v)
+			if seen[string(b)] {
+				return true
+			}
+			seen[string(b)] = true
+			return false
+		})
+	}
+	results = results[min(q.offset, len(results)):]
+	if q.limit >= 0 {
+		results = results[:min(q.limit, len(results))]
+	}
+	if q.top >= 0 {
+		results = results[:min(q.top, len(results))]
+	}
+	return results
+}
+
+// aggregate reports whether the query computes a single aggregate row.
+func (q *query) aggregate() bool {
+	if _, ok := q.value.(count); ok {
+		return true
+	}
+	for _, item := range q.items {
+		if _, ok := item.expr.(count); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// project returns the result for doc or, for aggregates, for group. ok is
+// false for undefined VALUE results, which are left out.
+func (q *query) project(doc map[string]any, group []map[string]any) (v any, ok bool) {
+	eval := func(e expr) (any, bool) {
+		if c, isCount := e.(count); isCount {
+			n := 0
+			for _, doc := range group {
+				if _, ok := c.x.eval(doc); ok {
+					n++
+				}
+			}
+			return float64(n), true
+		}
+		return e.eval(doc)
+	}
+	switch {
+	case q.star:
+		return doc, true
+	case q.value != nil:
+		return eval(q.value)
+	}
+	result := map[string]any{}
+	for _, item := range q.items {
+		if v, ok := eval(item.expr); ok {
+			result[item.name] = v
+		}
+	}
+	return result, true
+}
+
+// parseQuery parses text, binding the @-prefixed parameters in params.
+func parseQuery(text string, params map[string]any) (*query, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, fmt.Errorf("syntax error in query %q: %w", text, err)
+	}
+	p := &parser{tokens: tokens, params: params}
+	q, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("syntax error in query %q: %w", text, err)
+	}
+	return q, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenParam
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	rs := []rune(text)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		start := i
+		two := string(rs[i:min(i+2, len(rs))])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '@' || r == '_' || unicode.IsLetter(r):
+			i++
+			for i < len(rs) && (rs[i] == '_' || unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i])) {
+				i++
+			}
+			kind := tokenIdent
+			if r == '@' {
+				kind = tokenParam
+			}
+			tokens = append(tokens, token{kind, string(rs[start:i])})
+		case unicode.IsDigit(r) || r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			i++
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == 'e' || rs[i] == 'E' ||
+				(rs[i] == '+' || rs[i] == '-') && (rs[i-1] == 'e' || rs[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, string(rs[start:i])})
+		case r == '\'' || r == '"':
+			var b strings.Builder
+			for i++; i < len(rs) && rs[i] != r; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, b.String()})
+		case two == "!=" || two == "<>" || two == "<=" || two == ">=":
+			i += 2
+			tokens = append(tokens, token{tokenPunct, two})
+		case strings.ContainsRune("*,.()[]=<>", r):
+			i++
+			tokens = append(tokens, token{tokenPunct, string(r)})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	params map[string]any
+	alias  string
+	// unnamed counts the select items named $1, $2, ...
+	unnamed int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the keyword kw, matched case-insensitively, if it is next.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokenIdent && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// punct consumes the punctuation s if it is next.
+func (p *parser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.punct(s) {
+		return fmt.Errorf("expected %s, found %s", s, p.describe())
+	}
+	return nil
+}
+
+// describe names the next token for error messages.
+func (p *parser) describe() string {
+	if t := p.peek(); t.kind != tokenEOF {
+		return strconv.Quote(t.text)
+	}
+	return "end of query"
+}
+
+// reserved keywords cannot be used as names.
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "ORDER": true, "BY": true,
+	"AND": true, "OR": true, "NOT": true, "IN": true, "AS": true, "VALUE": true,
+	"TOP": true, "DISTINCT": true, "OFFSET": true, "LIMIT": true, "ASC": true,
+	"DESC": true, "TRUE": true, "FALSE": true, "NULL": true, "UNDEFINED": true,
+}
+
+// isName reports whether t is an identifier other than a keyword.
+func isName(t token) bool {
+	return t.kind == tokenIdent && !reserved[strings.ToUpper(t.text)]
+}
+
+func (p *parser) name() (string, error) {
+	if !isName(p.peek()) {
+		return "", fmt.Errorf("expected a name, found %s", p.describe())
+	}
+	return p.next().text, nil
+}
+
+func (p *parser) query() (*query, error) {
+	// The select list refers to the alias, which only follows it in FROM.
+	if err := p.findAlias(); err != nil {
+		return nil, err
+	}
+	q := &query{top: -1, limit: -1}
+	if !p.keyword("SELECT") {
+		return nil, fmt.Errorf("expected SELECT, found %s", p.describe())
+	}
+	q.distinct = p.keyword("DISTINCT")
+	if p.keyword("TOP") {
+		n, err := p.intArg()
+		if err != nil {
+			return nil, err
+		}
+		q.top = n
+	}
+	if err := p.selectClause(q); err != nil {
+		return nil, err
+	}
+	if !p.keyword("FROM") {
+		return nil, fmt.Errorf("expected FROM, found %s", p.describe())
+	}
+	// findAlias has checked the container and alias already.
+	p.next()
+	if p.keyword("AS") || isName(p.peek()) {
+		p.next()
+	}
+
+	if p.keyword("WHERE") {
+		where, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+	}
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return nil, fmt.Errorf("expected BY after ORDER, found %s", p.describe())
+		}
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{expr: e}
+			if p.keyword("DESC") {
+				item.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.punct(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("OFFSET") {
+		n, err := p.intArg()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("LIMIT") {
+			return nil, fmt.Errorf("expected LIMIT after OFFSET, found %s", p.describe())
+		}
+		m, err := p.intArg()
+		if err != nil {
+			return nil, err
+		}
+		q.offset, q.limit = n, m
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s", p.describe())
+	}
+
+	if q.top >= 0 && q.limit >= 0 {
+		return nil, fmt.Errorf("TOP cannot be combined with OFFSET LIMIT")
+	}
+	if q.aggregate() {
+		for _, item := range q.items {
+			if _, ok := item.expr.(count); !ok {
+				return nil, fmt.Errorf("%s must be an aggregate without GROUP BY", item.name)
+			}
+		}
+	}
+	return q, nil
+}
+
+// findAlias sets the alias of the container from the FROM clause, which is
+// the container name unless an alias follows it.
+func (p *parser) findAlias() error {
+	depth := 0
+	for i, t := range p.tokens {
+		switch {
+		case t.kind == tokenPunct && (t.text == "(" || t.text == "["):
+			depth++
+		case t.kind == tokenPunct && (t.text == ")" || t.text == "]"):
+			depth--
+		case depth == 0 && t.kind == tokenIdent && strings.EqualFold(t.text, "FROM"):
+			from := &parser{tokens: p.tokens[i+1:]}
+			name, err := from.name()
+			if err != nil {
+				return fmt.Errorf("expected a container after FROM, found %s", from.describe())
+			}
+			p.alias = name
+			if from.keyword("AS") || isName(from.peek()) {
+				if p.alias, err = from.name(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("expected FROM")
+}
+
+func (p *parser) selectClause(q *query) error {
+	if p.punct("*") {
+		q.star = true
+		return nil
+	}
+	if p.keyword("VALUE") {
+		e, err := p.expr()
+		q.value = e
+		return err
+	}
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return err
+		}
+		item := selectItem{expr: e}
+		if p.keyword("AS") {
+			if item.name, err = p.name(); err != nil {
+				return err
+			}
+		} else {
+			item.name = p.defaultName(e)
+		}
+		q.items = append(q.items, item)
+		if !p.punct(",") {
+			return nil
+		}
+	}
+}
+
+// defaultName names a select item without AS: the last property of a path,
+// the alias for the document itself and $1, $2, ... otherwise.
+func (p *parser) defaultName(e expr) string {
+	if pe, ok := e.(path); ok {
+		if len(pe.steps) == 0 {
+			return p.alias
+		}
+		if name, ok := pe.steps[len(pe.steps)-1].(string); ok {
+			return name
+		}
+	}
+	p.unnamed++
+	return "$" + strconv.Itoa(p.unnamed)
+}
+
+// intArg parses a non-negative integer literal or parameter.
+func (p *parser) intArg() (int, error) {
+	e, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	l, _ := e.(literal)
+	f, ok := l.v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("expected a non-negative integer")
+	}
+	return int(f), nil
+}
+
+// expr parses an expression. Precedence from lowest to highest is OR, AND,
+// NOT, then comparisons and IN.
+func (p *parser) expr() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.keyword("NOT") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return not{x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	negate := p.keyword("NOT")
+	if p.keyword("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		e := in{x: left}
+		for {
+			item, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			e.list = append(e.list, item)
+			if !p.punct(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if negate {
+			return not{e}, nil
+		}
+		return e, nil
+	}
+	if negate {
+		return nil, fmt.Errorf("expected IN after NOT, found %s", p.describe())
+	}
+	if t := p.peek(); t.kind == tokenPunct {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			return comparison{op: t.text, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenParam:
+		v, ok := p.params[t.text]
+		if !ok {
+			return nil, fmt.Errorf("parameter %s is not defined", t.text)
+		}
+		return literal{normalize(v)}, nil
+	case tokenString:
+		return literal{t.text}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return literal{f}, nil
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "[":
+			list := []any{}
+			for !p.punct("]") {
+				if len(list) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				e, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+				l, ok := e.(literal)
+				if !ok {
+					return nil, fmt.Errorf("array literals may only hold constants")
+				}
+				list = append(list, l.v)
+			}
+			return literal{list}, nil
+		}
+	case tokenIdent:
+		switch strings.ToUpper(t.text) {
+		case "TRUE":
+			return literal{true}, nil
+		case "FALSE":
+			return literal{false}, nil
+		case "NULL":
+			return literal{nil}, nil
+		case "UNDEFINED":
+			return undefinedLiteral{}, nil
+		}
+		if p.punct("(") {
+			return p.call(t.text)
+		}
+		if t.text != p.alias {
+			return nil, fmt.Errorf("identifier %q could not be resolved", t.text)
+		}
+		return p.path()
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// path parses the property accessors following the alias.
+func (p *parser) path() (expr, error) {
+	pe := path{}
+	for {
+		switch {
+		case p.punct("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a property name after ., found %q", t.text)
+			}
+			pe.steps = append(pe.steps, t.text)
+		case p.punct("["):
+			e, err := p.primary()
+			if err != nil {
+				return nil, err
+			}
+			l, _ := e.(literal)
+			switch v := l.v.(type) {
+			case string:
+				pe.steps = append(pe.steps, v)
+			case float64:
+				if v < 0 || v != math.Trunc(v) {
+					return nil, fmt.Errorf("invalid array index %v", v)
+				}
+				pe.steps = append(pe.steps, int(v))
+			default:
+				return nil, fmt.Errorf("expected a property name or array index in []")
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return pe, nil
+		}
+	}
+}
+
+// functions maps the supported functions to their minimum and maximum
+// number of arguments.
+var functions = map[string][2]int{
+	"STARTSWITH": {2, 3},
+	"IS_DEFINED": {1, 1},
+	"COUNT":      {1, 1},
+}
+
+// call parses the arguments of the function name.
+func (p *parser) call(name string) (expr, error) {
+	fn := strings.ToUpper(name)
+	arity, ok := functions[fn]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	var args []expr
+	for !p.punct(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+	if len(args) < arity[0] || len(args) > arity[1] {
+		return nil, fmt.Errorf("%s does not take %d arguments", fn, len(args))
+	}
+	switch fn {
+	case "STARTSWITH":
+		f := startsWith{s: args[0], prefix: args[1]}
+		if len(args) == 3 {
+			f.ignoreCase = args[2]
+		}
+		return f, nil
+	case "IS_DEFINED":
+		return isDefined{args[0]}, nil
+	}
+	return count{args[0]}, nil
+}
+
+// normalize converts a parameter value to the types decoded JSON has, which
+// are the only ones the evaluator handles.
+func normalize(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var n any
+	if err := json.Unmarshal(b, &n); err != nil {
+		return v
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const queryTestDocs = `[
+	{"id": "a", "store_id": "s1", "n": 3, "tags": ["red", "blue"], "owner": {"name": "Kate"}},
+	{"id": "b", "store_id": "s1", "n": 1, "tags": ["blue"], "owner": {"name": "kim"}},
+	{"id": "c", "store_id": "s2", "n": 2, "owner": null},
+	{"id": "d", "store_id": "s2", "n": "2"},
+	{"id": "e", "store_id": "s1", "n": 3, "flag": true}
+]`
+
+func queryDocs(t *testing.T) []map[string]any {
+	t.Helper()
+	var docs []map[string]any
+	if err := json.Unmarshal([]byte(queryTestDocs), &docs); err != nil {
+		t.Fatal(err)
+	}
+	return docs
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		params map[string]any
+		want   string
+	}{
+		{"select ids", `SELECT c.id FROM c WHERE c.store_id = @store_id`, map[string]any{"@store_id": "s2"}, `[{"id":"c"},{"id":"d"}]`},
+		{"and", `SELECT VALUE c.id FROM c WHERE c.id = @id AND c.store_id = @store_id`, map[string]any{"@id": "a", "@store_id": "s1"}, `["a"]`},
+		{"keywords are case insensitive", `select value c.id from c where c.n = 1`, nil, `["b"]`},
+		{"or", `SELECT VALUE c.id FROM c WHERE c.id = "a" OR c.id = 'c'`, nil, `["a","c"]`},
+		{"not", `SELECT VALUE c.id FROM c WHERE NOT c.store_id = "s1"`, nil, `["c","d"]`},
+		{"not equal", `SELECT VALUE c.id FROM c WHERE c.store_id != "s1"`, nil, `["c","d"]`},
+		{"not equal alternative", `SELECT VALUE c.id FROM c WHERE c.store_id <> "s1"`, nil, `["c","d"]`},
+		{"less than", `SELECT VALUE c.id FROM c WHERE c.n < 3`, nil, `["b","c"]`},
+		{"greater or equal", `SELECT VALUE c.id FROM c WHERE c.n >= 2`, nil, `["a","c","e"]`},
+		{"string comparison", `SELECT VALUE c.id FROM c WHERE c.id > "c"`, nil, `["d","e"]`},
+		{"mixed types are undefined", `SELECT VALUE c.id FROM c WHERE c.n = "2" OR c.n > "1"`, nil, `["d"]`},
+		{"missing properties are undefined", `SELECT VALUE c.id FROM c WHERE c.flag = true OR NOT c.flag = true`, nil, `["e"]`},
+		{"in", `SELECT VALUE c.id FROM c WHERE c.id IN ("b", "d", "z")`, nil, `["b","d"]`},
+		{"not in", `SELECT VALUE c.id FROM c WHERE c.id NOT IN ("b", "d")`, nil, `["a","c","e"]`},
+		{"in with parameters", `SELECT VALUE c.id FROM c WHERE c.n IN (@one, @two)`, map[string]any{"@one": 1, "@two": 2}, `["b","c"]`},
+		{"startswith", `SELECT VALUE c.id FROM c WHERE STARTSWITH(c.owner.name, "K")`, nil, `["a"]`},
+		{"startswith ignoring case", `SELECT VALUE c.id FROM c WHERE STARTSWITH(c.owner.name, "k", true)`, nil, `["a","b"]`},
+		{"is_defined", `SELECT VALUE c.id FROM c WHERE IS_DEFINED(c.owner)`, nil, `["a","b","c"]`},
+		{"not is_defined", `SELECT VALUE c.id FROM c WHERE NOT IS_DEFINED(c.tags)`, nil, `["c","d","e"]`},
+		{"null", `SELECT VALUE c.id FROM c WHERE c.owner = null`, nil, `["c"]`},
+		{"nested paths", `SELECT c.owner.name, c["tags"][0] FROM c WHERE c.store_id = "s1"`, nil, `[{"name":"Kate","$1":"red"},{"name":"kim","$1":"blue"},{}]`},
+		{"aliases", `SELECT c.id AS key, c.n AS count FROM c WHERE c.id = "a"`, nil, `[{"key":"a","count":3}]`},
+		{"container alias", `SELECT VALUE f.id FROM Families f WHERE f.n = 1`, nil, `["b"]`},
+		{"container alias with AS", `SELECT VALUE f.id FROM Families AS f WHERE f.n = 1`, nil, `["b"]`},
+		{"select the alias", `SELECT c FROM c WHERE c.id = "d"`, nil, `[{"c":{"id":"d","store_id":"s2","n":"2"}}]`},
+		{"star", `SELECT * FROM c WHERE c.id = "d"`, nil, `[{"id":"d","store_id":"s2","n":"2"}]`},
+		{"value skips undefined", `SELECT VALUE c.flag FROM c`, nil, `[true]`},
+		{"value keeps null", `SELECT VALUE c.owner FROM c WHERE c.id = "c"`, nil, `[null]`},
+		{"count", `SELECT VALUE COUNT(1) FROM c WHERE c.store_id = "s1"`, nil, `[3]`},
+		{"count of property", `SELECT COUNT(c.tags) AS tagged FROM c`, nil, `[{"tagged":2}]`},
+		{"count without name", `SELECT COUNT(1) FROM c WHERE c.id = "z"`, nil, `[{"$1":0}]`},
+		{"distinct", `SELECT DISTINCT VALUE c.store_id FROM c`, nil, `["s1","s2"]`},
+		{"distinct objects", `SELECT DISTINCT c.n FROM c WHERE c.store_id = "s1"`, nil, `[{"n":3},{"n":1}]`},
+		{"order by", `SELECT VALUE c.id FROM c WHERE c.store_id = "s1" ORDER BY c.n`, nil, `["b","a","e"]`},
+		{"order by descending", `SELECT VALUE c.id FROM c ORDER BY c.id DESC`, nil, `["e","d","c","b","a"]`},
+		{"order by several", `SELECT VALUE c.id FROM c WHERE c.store_id = "s1" ORDER BY c.n DESC, c.id DESC`, nil, `["e","a","b"]`},
+		{"order by mixed types", `SELECT VALUE c.id FROM c ORDER BY c.n ASC, c.id`, nil, `["b","c","a","e","d"]`},
+		{"order by undefined first", `SELECT VALUE c.id FROM c ORDER BY c.flag DESC, c.id`, nil, `["e","a","b","c","d"]`},
+		{"top", `SELECT TOP 2 VALUE c.id FROM c ORDER BY c.id DESC`, nil, `["e","d"]`},
+		{"top parameter", `SELECT TOP @n VALUE c.id FROM c`, map[string]any{"@n": 1}, `["a"]`},
+		{"offset limit", `SELECT VALUE c.id FROM c ORDER BY c.id OFFSET 1 LIMIT 2`, nil, `["b","c"]`},
+		{"offset past the end", `SELECT VALUE c.id FROM c OFFSET 10 LIMIT 2`, nil, `[]`},
+		{"parenthesized filter", `SELECT VALUE c.id FROM c WHERE c.store_id = @s AND (c.n = 1 OR c.n = 2)`, map[string]any{"@s": "s1"}, `["b"]`},
+		{"array parameter", `SELECT VALUE c.id FROM c WHERE c.tags = @tags`, map[string]any{"@tags": []string{"blue"}}, `["b"]`},
+		{"object literal parameter", `SELECT VALUE c.id FROM c WHERE c.owner = @owner`, map[string]any{"@owner": map[string]any{"name": "kim"}}, `["b"]`},
+		{"array literal", `SELECT VALUE c.id FROM c WHERE c.tags = ["red", "blue"]`, nil, `["a"]`},
+		{"escaped string", `SELECT VALUE c.id FROM c WHERE c.id = 'it\'s'`, nil, `[]`},
+		{"numbers", `SELECT VALUE c.id FROM c WHERE c.n > -1.5e0 AND c.n < 2.5`, nil, `["b","c"]`},
+		{"undefined literal", `SELECT VALUE c.id FROM c WHERE c.flag = undefined`, nil, `[]`},
+	}
+	docs := queryDocs(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseQuery(tt.query, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(q.run(docs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mustCanonical(t, string(got)) != mustCanonical(t, tt.want) {
+				t.Errorf("%s\n got %s\nwant %s", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// System properties are set by the account rather than decoded from
+	// JSON, and must compare like the properties that are.
+	a := NewAccount(&Options{Now: func() time.Time { return time.Unix(1700000000, 0) }})
+	if err := a.CreateContainer("db", "items"); err != nil {
+		t.Fatal(err)
+	}
+	db := a.databases["db"]
+	written := []map[string]any{a.newItem(db, db.containers["items"], map[string]any{"id": "f"}, nil).body}
+	for _, tt := range []struct {
+		query string
+		since int64
+		want  string
+	}{
+		{`SELECT VALUE c.id FROM c WHERE c._ts > 0`, 0, `["f"]`},
+		{`SELECT VALUE c.id FROM c WHERE c._ts >= @since`, 1700000000, `["f"]`},
+		{`SELECT VALUE c.id FROM c WHERE c._ts > @since`, 1700000000, `[]`},
+		{`SELECT VALUE c._ts FROM c ORDER BY c._ts`, 0, `[1700000000]`},
+	} {
+		q, err := parseQuery(tt.query, map[string]any{"@since": tt.since})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(q.run(written)); string(got) != tt.want {
+			t.Errorf("%s of a written item = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+// mustCanonical re-encodes a JSON document with sorted object keys.
+func mustCanonical(t *testing.T, s string) string {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", s, err)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"empty", ``},
+		{"no select", `FROM c`},
+		{"no from", `SELECT *`},
+		{"unknown alias", `SELECT * FROM c WHERE d.id = "a"`},
+		{"undefined parameter", `SELECT * FROM c WHERE c.id = @id`},
+		{"unknown function", `SELECT * FROM c WHERE ENDSWITH(c.id, "a")`},
+		{"wrong arity", `SELECT * FROM c WHERE IS_DEFINED(c.id, c.n)`},
+		{"unterminated string", `SELECT * FROM c WHERE c.id = "a`},
+		{"unbalanced parentheses", `SELECT * FROM c WHERE (c.id = "a"`},
+		{"trailing tokens", `SELECT * FROM c WHERE c.id = "a" c.n`},
+		{"negative top", `SELECT TOP -1 * FROM c`},
+		{"offset without limit", `SELECT * FROM c OFFSET 1`},
+		{"top with offset", `SELECT TOP 1 * FROM c OFFSET 1 LIMIT 1`},
+		{"aggregate mixed with properties", `SELECT c.id, COUNT(1) FROM c`},
+		{"order without by", `SELECT * FROM c ORDER c.id`},
+		{"not without in", `SELECT * FROM c WHERE c.id NOT = "a"`},
+		{"invalid character", `SELECT * FROM c WHERE c.n = 1 + 1`},
+		{"keyword as alias", `SELECT * FROM c AS where`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseQuery(tt.query, nil); err == nil {
+				t.Errorf("parseQuery(%q) succeeded, want error", tt.query)
+			}
+		})
+	}
+}
+
+func TestParseQueryRequestBindsParameters(t *testing.T) {
+	body := []byte(`{"query":"SELECT VALUE c.id FROM c WHERE c.store_id = @store_id AND c.n = @n","parameters":[{"name":"@store_id","value":"s1"},{"name":"@n","value":3}]}`)
+	q, err := parseQueryRequest(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(q.run(queryDocs(t))); string(b) != `["a","e"]` {
+		t.Errorf("results = %s, want [\"a\",\"e\"]", b)
+	}
+}
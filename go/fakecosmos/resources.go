@@ -0,0 +1,229 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultIndexingPolicy is returned for containers created without one.
+var defaultIndexingPolicy = json.RawMessage(`{"indexingMode":"consistent","automatic":true,"includedPaths":[{"path":"/*"}],"excludedPaths":[{"path":"/\"_etag\"/?"}]}`)
+
+func (db *database) properties() map[string]any {
+	return map[string]any{
+		"id":     db.id,
+		"_rid":   ridString(db.rid),
+		"_self":  "dbs/" + ridString(db.rid) + "/",
+		"_etag":  db.etag,
+		"_colls": "colls/",
+		"_users": "users/",
+		"_ts":    db.ts,
+	}
+}
+
+func (c *container) properties(db *database) map[string]any {
+	props := map[string]any{
+		"id":    c.id,
+		"_rid":  ridString(c.rid),
+		"_self": "dbs/" + ridString(db.rid) + "/colls/" + ridString(c.rid) + "/",
+		"_etag": c.etag,
+		"_ts":   c.ts,
+		"_docs": "docs/",
+		"partitionKey": map[string]any{
+			"paths":   c.partitionKeyPaths,
+			"kind":    "Hash",
+			"version": 2,
+		},
+		"indexingPolicy": c.indexingPolicy,
+	}
+	if c.indexingPolicy == nil {
+		props["indexingPolicy"] = defaultIndexingPolicy
+	}
+	if c.defaultTTL != nil {
+		props["defaultTtl"] = *c.defaultTTL
+	}
+	return props
+}
+
+// isQuery reports whether a POST to a feed is a query rather than a create.
+func (req *request) isQuery() bool {
+	return strings.EqualFold(req.header.Get(headerIsQuery), "true") ||
+		strings.HasPrefix(req.header.Get("Content-Type"), contentTypeQueryJSON)
+}
+
+func (a *Account) databaseFeed(req *request) *response {
+	switch {
+	case req.method == http.MethodGet:
+		return feedResponse("", "Databases", a.databaseList())
+	case req.method == http.MethodPost && req.isQuery():
+		return a.queryResources(req, "", "Databases", a.databaseList())
+	case req.method == http.MethodPost:
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(req.body, &body); err != nil {
+			return badRequest("invalid database: %v", err)
+		}
+		if _, ok := a.databases[body.ID]; ok {
+			return conflict()
+		}
+		db, err := a.createDatabase(body.ID)
+		if err != nil {
+			return badRequest("%v", err)
+		}
+		return newResponse(http.StatusCreated, db.properties())
+	}
+	return methodNotAllowed()
+}
+
+func (a *Account) databaseList() []map[string]any {
+	ids := slices.Sorted(maps.Keys(a.databases))
+	list := make([]map[string]any, len(ids))
+	for i, id := range ids {
+		list[i] = a.databases[id].properties()
+	}
+	return list
+}
+
+// databaseResource serves dbs/{id}. db is nil if the database does not exist.
+func (a *Account) databaseResource(req *request, db *database, id string) *response {
+	if db == nil {
+		return notFound()
+	}
+	switch req.method {
+	case http.MethodGet:
+		return newResponse(http.StatusOK, db.properties())
+	case http.MethodDelete:
+		delete(a.databases, id)
+		a.persist(&logRecord{Op: opDeleteDatabase, Database: id})
+		return newResponse(http.StatusNoContent, nil)
+	}
+	return methodNotAllowed()
+}
+
+func (a *Account) containerFeed(req *request, db *database) *response {
+	switch {
+	case req.method == http.MethodGet:
+		return feedResponse(ridString(db.rid), "DocumentCollections", a.containerList(db))
+	case req.method == http.MethodPost && req.isQuery():
+		return a.queryResources(req, ridString(db.rid), "DocumentCollections", a.containerList(db))
+	case req.method == http.MethodPost:
+		var body struct {
+			ID           string `json:"id"`
+			PartitionKey struct {
+				Paths []string `json:"paths"`
+			} `json:"partitionKey"`
+			DefaultTTL     *int            `json:"defaultTtl"`
+			IndexingPolicy json.RawMessage `json:"indexingPolicy"`
+		}
+		if err := json.Unmarshal(req.body, &body); err != nil {
+			return badRequest("invalid container: %v", err)
+		}
+		if _, ok := db.containers[body.ID]; ok {
+			return conflict()
+		}
+		if len(body.PartitionKey.Paths) == 0 {
+			return badRequest("The partition key definition is missing.")
+		}
+		c, err := a.createContainer(db, body.ID, body.PartitionKey.Paths)
+		if err != nil {
+			return badRequest("%v", err)
+		}
+		c.defaultTTL = body.DefaultTTL
+		if len(body.IndexingPolicy) > 0 && string(body.IndexingPolicy) != "null" {
+			c.indexingPolicy = body.IndexingPolicy
+		}
+		if ru, ok := req.offerThroughput(); ok {
+			c.budget.setThroughput(ru, a.now())
+		}
+		a.persist(containerRecord(db, c))
+		return newResponse(http.StatusCreated, c.properties(db))
+	}
+	return methodNotAllowed()
+}
+
+func (a *Account) containerList(db *database) []map[string]any {
+	ids := slices.Sorted(maps.Keys(db.containers))
+	list := make([]map[string]any, len(ids))
+	for i, id := range ids {
+		list[i] = db.containers[id].properties(db)
+	}
+	return list
+}
+
+// containerResource serves dbs/{db}/colls/{id}. c is nil if the container does
+// not exist.
+func (a *Account) containerResource(req *request, db *database, c *container, id string) *response {
+	if c == nil {
+		return notFound()
+	}
+	switch req.method {
+	case http.MethodGet:
+		return newResponse(http.StatusOK, c.properties(db))
+	case http.MethodPut:
+		var body struct {
+			DefaultTTL     *int            `json:"defaultTtl"`
+			IndexingPolicy json.RawMessage `json:"indexingPolicy"`
+		}
+		if err := json.Unmarshal(req.body, &body); err != nil {
+			return badRequest("invalid container: %v", err)
+		}
+		c.defaultTTL, c.nextExpiry = body.DefaultTTL, 0
+		if len(body.IndexingPolicy) > 0 && string(body.IndexingPolicy) != "null" {
+			c.indexingPolicy = body.IndexingPolicy
+		}
+		c.etag = a.newETag()
+		c.ts = a.now().Unix()
+		a.persist(containerRecord(db, c))
+		return newResponse(http.StatusOK, c.properties(db))
+	case http.MethodDelete:
+		delete(db.containers, id)
+		a.persist(&logRecord{Op: opDeleteContainer, Database: db.id, Container: id})
+		return newResponse(http.StatusNoContent, nil)
+	}
+	return methodNotAllowed()
+}
+
+// readPartitionKeyRanges reports a single physical partition covering the
+// whole hash range.
+func (a *Account) readPartitionKeyRanges(req *request, db *database, c *container) *response {
+	if req.method != http.MethodGet {
+		return methodNotAllowed()
+	}
+	return feedResponse(ridString(c.rid), "PartitionKeyRanges", []map[string]any{{
+		"id":           "0",
+		"_rid":         ridString(c.rid),
+		"minInclusive": "",
+		"maxExclusive": "FF",
+		"status":       "online",
+		"parents":      []string{},
+	}})
+}
+
+// queryResources runs a query over database or container properties.
+func (a *Account) queryResources(req *request, rid, kind string, resources []map[string]any) *response {
+	q, err := parseQueryRequest(req.body)
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	return feedResponse(rid, kind, q.run(resources))
+}
+
+// feedResponse returns a page of resources in the envelope of a feed. rid is
+// the resource id of the feed's owner.
+func feedResponse[T any](rid, kind string, resources []T) *response {
+	resp := newResponse(http.StatusOK, map[string]any{
+		"_rid":   rid,
+		kind:     resources,
+		"_count": len(resources),
+	})
+	resp.header.Set(headerItemCount, strconv.Itoa(len(resources)))
+	return resp
+}
+
+func conflict() *response {
+	return errorResponse(http.StatusConflict, "Conflict", "Entity with the specified id already exists in the system.")
+}
@@ -0,0 +1,140 @@
+package fakecosmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Approximate request charges, in request units. Point operations scale with
+// the size of the item in KB, rounded up.
+const (
+	chargeReadPerKB  = 1
+	chargeWritePerKB = 5.71
+	chargeDelete     = 5.71
+	// Queries cost a base charge, plus a charge per document scanned on the
+	// first page and per KB returned on every page. Sorting, DISTINCT and
+	// aggregates cost extra, as does fanning out to every partition.
+	chargeQueryBase           = 2.79
+	chargeQueryPerScan        = 0.02
+	chargeQueryPerKB          = 0.1
+	chargeQueryOrderBy        = 0.4
+	chargeQueryDistinct       = 0.5
+	chargeQueryAggregate      = 1
+	chargeQueryCrossPartition = 1
+	// A change feed page costs as much as a read feed page, and a poll that
+	// finds no changes costs one RU.
+	chargeChangeFeedNotModified = 1
+)
+
+// kilobytes returns the encoded size of v in KB, rounded up and at least one.
+func kilobytes(v any) float64 {
+	b, _ := json.Marshal(v)
+	return max(1, math.Ceil(float64(len(b))/1024))
+}
+
+// queryCharge returns the charge of one page of a query.
+func queryCharge(q *query, scanned int, page []any, first, crossPartition bool) float64 {
+	charge := chargeQueryBase + chargeQueryPerKB*kilobytes(page)
+	if first {
+		charge += chargeQueryPerScan * float64(scanned)
+	}
+	charge += chargeQueryOrderBy * float64(len(q.orderBy))
+	if q.distinct {
+		charge += chargeQueryDistinct
+	}
+	if q.aggregate() {
+		charge += chargeQueryAggregate
+	}
+	if crossPartition {
+		charge += chargeQueryCrossPartition
+	}
+	return charge
+}
+
+// bucket is the request unit budget of a container: a token bucket holding
+// up to one second of its throughput.
+type bucket struct {
+	// throughput is the provisioned RU/s; zero is unlimited.
+	throughput float64
+	tokens     float64
+	refilled   time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.refilled).Seconds()
+	b.tokens = min(b.throughput, b.tokens+elapsed*b.throughput)
+	b.refilled = now
+}
+
+// admit returns a 429 response if the budget is exhausted. A request that is
+// admitted may take the budget below zero; later requests are throttled
+// until it refills, as in Cosmos DB.
+func (b *bucket) admit(now time.Time) *response {
+	if b.throughput <= 0 {
+		return nil
+	}
+	b.refill(now)
+	if b.tokens > 0 {
+		return nil
+	}
+	wait := time.Duration(math.Ceil(-b.tokens/b.throughput*1000)) * time.Millisecond
+	resp := errorResponse(http.StatusTooManyRequests, "TooManyRequests",
+		"Request rate is large. More Request Units may be needed, so no changes were made. Please retry this request later. Learn more: http://aka.ms/cosmosdb-error-429")
+	resp.header.Set(headerSubstatus, "3200")
+	resp.header.Set(headerRetryAfterMS, strconv.FormatInt(max(wait.Milliseconds(), 1), 10))
+	return resp
+}
+
+// consume takes the charge of resp from the budget.
+func (b *bucket) consume(resp *response) {
+	if b.throughput <= 0 {
+		return
+	}
+	charge, _ := strconv.ParseFloat(resp.header.Get(headerRequestCharge), 64)
+	b.tokens -= charge
+}
+
+func (b *bucket) setThroughput(throughput float64, now time.Time) {
+	b.throughput = throughput
+	b.tokens = throughput
+	b.refilled = now
+}
+
+// SetThroughput provisions throughput RU/s for a container. Zero removes the
+// limit.
+func (a *Account) SetThroughput(databaseID, containerID string, throughput float64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	db, ok := a.databases[databaseID]
+	if !ok {
+		return fmt.Errorf("database %s does not exist", databaseID)
+	}
+	c, ok := db.containers[containerID]
+	if !ok {
+		return fmt.Errorf("container %s does not exist in database %s", containerID, databaseID)
+	}
+	c.budget.setThroughput(throughput, a.now())
+	a.persist(containerRecord(db, c))
+	return a.logErr
+}
+
+// offerThroughput returns the throughput requested when creating a
+// container, manual or autoscale, and whether there was one.
+func (req *request) offerThroughput() (float64, bool) {
+	if h := req.header.Get("x-ms-offer-throughput"); h != "" {
+		ru, err := strconv.ParseFloat(h, 64)
+		return ru, err == nil
+	}
+	if h := req.header.Get("x-ms-cosmos-offer-autopilot-settings"); h != "" {
+		var settings struct {
+			MaxThroughput float64 `json:"maxThroughput"`
+		}
+		err := json.Unmarshal([]byte(h), &settings)
+		return settings.MaxThroughput, err == nil
+	}
+	return 0, false
+}
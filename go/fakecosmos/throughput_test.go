@@ -0,0 +1,85 @@
+package fakecosmos
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// statusRecorder records the status of every response it receives.
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses []int
+}
+
+func (r *statusRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		r.mu.Lock()
+		r.statuses = append(r.statuses, resp.StatusCode)
+		r.mu.Unlock()
+	}
+	return resp, err
+}
+
+func TestThroughput(t *testing.T) {
+	ctx := testContext(t)
+	// Writes of small items cost 5.71 RU, so four of them take the bucket
+	// of 20 RU below zero for about 150ms. The clock stands still, so it
+	// does not refill.
+	now := time.Now()
+	c, _ := newTestContainer(t, &Options{Throughput: 20, Now: func() time.Time { return now }}, &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
+		Retry: policy.RetryOptions{MaxRetries: -1},
+	}})
+	writeItems(ctx, t, c, "p", "a", "b", "c", "d")
+
+	_, err := c.ReadItem(ctx, azcosmos.NewPartitionKeyString("p"), "a", nil)
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("read over budget: error = %v, want 429", err)
+	}
+	header := respErr.RawResponse.Header
+	if got := header.Get("x-ms-substatus"); got != "3200" {
+		t.Errorf("x-ms-substatus = %q, want 3200", got)
+	}
+	retryAfter, err := strconv.Atoi(header.Get("x-ms-retry-after-ms"))
+	// The bucket is 2.84 RU short, which takes 142ms to refill; the wait
+	// is rounded up.
+	if err != nil || retryAfter < 142 || retryAfter > 143 {
+		t.Errorf("x-ms-retry-after-ms = %q, want 142 or 143", header.Get("x-ms-retry-after-ms"))
+	}
+	if got := respErr.RawResponse.Header.Get("x-ms-request-charge"); got != "" && got != "0" {
+		t.Errorf("a throttled request was charged %s RU", got)
+	}
+}
+
+func TestThroughputRetry(t *testing.T) {
+	ctx := testContext(t)
+	recorder := &statusRecorder{}
+	c, _ := newTestContainer(t, &Options{Throughput: 20}, &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
+		Transport: recorder,
+	}})
+	writeItems(ctx, t, c, "p", "a", "b", "c", "d")
+
+	// The SDK waits as long as x-ms-retry-after-ms says, by which time the
+	// bucket has refilled enough to admit the read.
+	recorder.statuses = nil
+	start := time.Now()
+	if _, err := c.ReadItem(ctx, azcosmos.NewPartitionKeyString("p"), "a", nil); err != nil {
+		t.Fatalf("read with retries: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("read succeeded after %s, before the bucket refilled", elapsed)
+	}
+	if want := []int{http.StatusTooManyRequests, http.StatusOK}; !slices.Equal(recorder.statuses, want) {
+		t.Errorf("statuses = %v, want %v", recorder.statuses, want)
+	}
+}
@@ -0,0 +1,49 @@
+package fakecosmos
+
+import "math"
+
+// expiry returns the Unix time at which it expires, and false if it never
+// does. Time to live is off unless the container has a defaultTtl; then an
+// item's ttl property overrides it, and -1 means never.
+func (c *container) expiry(it *item) (int64, bool) {
+	if c.defaultTTL == nil {
+		return 0, false
+	}
+	ttl := float64(*c.defaultTTL)
+	if v, ok := it.body["ttl"].(float64); ok {
+		ttl = v
+	}
+	if ttl <= 0 {
+		return 0, false
+	}
+	ts, _ := it.body["_ts"].(float64)
+	return int64(ts) + int64(ttl), true
+}
+
+// expireItems deletes the items of c whose time to live has passed. Cosmos DB
+// deletes them in the background but never returns them once expired, so
+// deleting them before each item request is equivalent.
+func (a *Account) expireItems(db *database, c *container) {
+	now := a.now().Unix()
+	if c.defaultTTL == nil || now < c.nextExpiry {
+		return
+	}
+	c.nextExpiry = math.MaxInt64
+	var recs []*logRecord
+	for pk, partition := range c.items {
+		for id, it := range partition {
+			exp, ok := c.expiry(it)
+			switch {
+			case !ok:
+			case exp <= now:
+				c.deleteItem(pk, id)
+				recs = append(recs, &logRecord{Op: opDeleteItem, Database: db.id, Container: c.id, PartitionKey: pk, ID: id})
+			default:
+				c.nextExpiry = min(c.nextExpiry, exp)
+			}
+		}
+	}
+	if len(recs) > 0 {
+		a.persist(recs...)
+	}
+}
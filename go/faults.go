@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// Faults injected by FaultTransport.
+const (
+	FaultDrop        = "drop"
+	FaultThrottle    = "429"
+	FaultUnavailable = "503"
+	FaultGone        = "410"
+	FaultTruncate    = "truncate"
+)
+
+// LatencyDistribution draws the extra latency added to a request.
+type LatencyDistribution interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// FixedLatency always adds the same delay.
+type FixedLatency time.Duration
+
+func (l FixedLatency) Sample(*rand.Rand) time.Duration { return time.Duration(l) }
+
+// UniformLatency adds a delay uniformly distributed in [Min, Max].
+type UniformLatency struct{ Min, Max time.Duration }
+
+func (l UniformLatency) Sample(r *rand.Rand) time.Duration {
+	return l.Min + time.Duration(r.Int64N(int64(l.Max-l.Min)+1))
+}
+
+// ExponentialLatency adds an exponentially distributed delay, which gives the
+// long tail typical of network latency.
+type ExponentialLatency struct{ Mean time.Duration }
+
+func (l ExponentialLatency) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(l.Mean))
+}
+
+// NormalLatency adds a normally distributed delay, never less than zero.
+type NormalLatency struct{ Mean, StdDev time.Duration }
+
+func (l NormalLatency) Sample(r *rand.Rand) time.Duration {
+	return max(0, time.Duration(r.NormFloat64()*float64(l.StdDev)+float64(l.Mean)))
+}
+
+// ParseLatency parses fixed:50ms, uniform:10ms-100ms, exp:20ms or
+// normal:50ms/10ms.
+func ParseLatency(spec string) (LatencyDistribution, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	durations := func(sep string, n int) ([]time.Duration, error) {
+		parts := []string{args}
+		if sep != "" {
+			parts = strings.Split(args, sep)
+		}
+		if len(parts) != n {
+			return nil, fmt.Errorf("latency %q: expected %d durations", spec, n)
+		}
+		ds := make([]time.Duration, n)
+		for i, p := range parts {
+			d, err := time.ParseDuration(p)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("latency %q: invalid duration %q", spec, p)
+			}
+			ds[i] = d
+		}
+		return ds, nil
+	}
+	switch kind {
+	case "fixed":
+		ds, err := durations("", 1)
+		if err != nil {
+			return nil, err
+		}
+		return FixedLatency(ds[0]), nil
+	case "uniform":
+		ds, err := durations("-", 2)
+		if err != nil {
+			return nil, err
+		}
+		if ds[1] < ds[0] {
+			return nil, fmt.Errorf("latency %q: max is below min", spec)
+		}
+		return UniformLatency{Min: ds[0], Max: ds[1]}, nil
+	case "exp":
+		ds, err := durations("", 1)
+		if err != nil {
+			return nil, err
+		}
+		return ExponentialLatency{Mean: ds[0]}, nil
+	case "normal":
+		ds, err := durations("/", 2)
+		if err != nil {
+			return nil, err
+		}
+		return NormalLatency{Mean: ds[0], StdDev: ds[1]}, nil
+	}
+	return nil, fmt.Errorf("unknown latency distribution %q", kind)
+}
+
+// FaultConfig configures FaultTransport. Rates are probabilities per request
+// and are checked in the order drop, 429, 503, 410, truncate; at most one
+// fault is injected per request.
+type FaultConfig struct {
+	Seed       uint64
+	Latency    LatencyDistribution
+	Rates      map[string]float64
+	RetryAfter time.Duration
+}
+
+// ParseFaultConfig parses a comma separated list such as
+// "latency=exp:20ms,429=0.05,drop=0.01,retry-after=100ms,seed=7".
+func ParseFaultConfig(spec string) (FaultConfig, error) {
+	cfg := FaultConfig{Seed: 1, Rates: map[string]float64{}, RetryAfter: 100 * time.Millisecond}
+	for _, field := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return cfg, fmt.Errorf("fault %q: expected name=value", field)
+		}
+		var err error
+		switch name {
+		case "latency":
+			cfg.Latency, err = ParseLatency(value)
+		case "seed":
+			cfg.Seed, err = strconv.ParseUint(value, 10, 64)
+		case "retry-after":
+			cfg.RetryAfter, err = time.ParseDuration(value)
+		case FaultDrop, FaultThrottle, FaultUnavailable, FaultGone, FaultTruncate:
+			var rate float64
+			rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (rate < 0 || rate > 1) {
+				err = fmt.Errorf("rate must be between 0 and 1")
+			}
+			cfg.Rates[name] = rate
+		default:
+			err = fmt.Errorf("unknown fault")
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("fault %q: %w", field, err)
+		}
+	}
+	return cfg, nil
+}
+
+// FaultTransport is an http.RoundTripper that delays requests and injects
+// failures the way Cosmos DB and the network produce them. It also implements
+// policy.Transporter, so it can be set as azcore.ClientOptions.Transport.
+type FaultTransport struct {
+	next http.RoundTripper
+	cfg  FaultConfig
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	injected map[string]int
+}
+
+// NewFaultTransport wraps next. A nil next uses http.DefaultTransport.
+func NewFaultTransport(next http.RoundTripper, cfg FaultConfig) *FaultTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &FaultTransport{
+		next:     next,
+		cfg:      cfg,
+		rng:      rand.New(rand.NewPCG(cfg.Seed, splitmix64(cfg.Seed))),
+		injected: map[string]int{},
+	}
+}
+
+// Injected returns how often each fault was injected.
+func (t *FaultTransport) Injected() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int, len(t.injected))
+	for k, v := range t.injected {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Do implements policy.Transporter.
+func (t *FaultTransport) Do(req *http.Request) (*http.Response, error) {
+	return t.RoundTrip(req)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, fault, cut := t.draw()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch fault {
+	case FaultDrop:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	case FaultThrottle:
+		return t.errorResponse(req, http.StatusTooManyRequests, 3200, "TooManyRequests",
+			"Request rate is large. More Request Units may be needed, so no changes were made. Please retry this request later."), nil
+	case FaultUnavailable:
+		return t.errorResponse(req, http.StatusServiceUnavailable, 0, "ServiceUnavailable",
+			"Service is currently unavailable. Please retry this request later."), nil
+	case FaultGone:
+		return t.errorResponse(req, http.StatusGone, 1002, "Gone",
+			"The requested partition key range is gone."), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || fault != FaultTruncate {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &truncatedBody{r: bytes.NewReader(body[:int(cut*float64(len(body)))])}
+	return resp, nil
+}
+
+// draw decides the latency and fault of one request. For a given seed the
+// n-th request always gets the same decision.
+func (t *FaultTransport) draw() (delay time.Duration, fault string, cut float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.Latency != nil {
+		delay = t.cfg.Latency.Sample(t.rng)
+	}
+	for _, f := range []string{FaultDrop, FaultThrottle, FaultUnavailable, FaultGone, FaultTruncate} {
+		if rate := t.cfg.Rates[f]; rate > 0 && t.rng.Float64() < rate {
+			fault = f
+			t.injected[f]++
+			break
+		}
+	}
+	return delay, fault, t.rng.Float64()
+}
+
+func (t *FaultTransport) errorResponse(req *http.Request, status, substatus int, code, message string) *http.Response {
+	// Activity ids come from the global source so they do not disturb the
+	// seeded sequence of faults.
+	activityID := fmt.Sprintf("%08x-%04x-4%03x-8%03x-%012x",
+		rand.Uint32(), rand.IntN(1<<16), rand.IntN(1<<12), rand.IntN(1<<12), rand.Int64N(1<<48))
+	body := fmt.Sprintf(`{"code":%q,"message":"Message: {\"Errors\":[%q]}\r\nActivityId: %s, Request URI: %s"}`,
+		code, message, activityID, req.URL.Path)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("x-ms-activity-id", activityID)
+	header.Set("x-ms-request-charge", "0")
+	header.Set("x-ms-substatus", strconv.Itoa(substatus))
+	header.Set("x-ms-gatewayversion", "2.0.0")
+	if status == http.StatusTooManyRequests {
+		header.Set("x-ms-retry-after-ms", strconv.FormatInt(int64(math.Ceil(float64(t.cfg.RetryAfter)/float64(time.Millisecond))), 10))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF after its content, as a
+// connection closed mid-response does.
+type truncatedBody struct {
+	r *bytes.Reader
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *truncatedBody) Close() error { return nil }
+
+// transporterRoundTripper adapts a policy.Transporter to an http.RoundTripper.
+type transporterRoundTripper struct {
+	policy.Transporter
+}
+
+func (t transporterRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.Do(req)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// faultSwitch sends requests through faults once it is on, and counts them.
+// Until then they go straight to next, so the SDK can read the account and
+// the test can set up its items.
+type faultSwitch struct {
+	faults   *FaultTransport
+	next     policy.Transporter
+	on       atomic.Bool
+	attempts atomic.Int32
+}
+
+func (s *faultSwitch) Do(req *http.Request) (*http.Response, error) {
+	if !s.on.Load() {
+		return s.next.Do(req)
+	}
+	s.attempts.Add(1)
+	return s.faults.Do(req)
+}
+
+// faultyStore returns a store in the fake whose requests go through a
+// FaultTransport injecting the faults of spec once the switch is on.
+func faultyStore(t *testing.T, spec string) (*KeyValueStore, *faultSwitch) {
+	t.Helper()
+	cfg, err := ParseFaultConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw := &faultSwitch{
+		faults: NewFaultTransport(transporterRoundTripper{http.DefaultClient}, cfg),
+		next:   http.DefaultClient,
+	}
+	container := fakeClient(t, fakeServer(t, nil, "faults"), "faults", &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{
+		Transport: sw,
+		Retry:     policy.RetryOptions{MaxRetries: 3, RetryDelay: time.Millisecond, MaxRetryDelay: time.Millisecond},
+	}})
+	return NewKeyValueStore(container, "faults"), sw
+}
+
+func TestFaultsAgainstFake(t *testing.T) {
+	tests := []struct {
+		fault    string
+		attempts int32
+		check    func(err error) bool
+		want     string
+	}{
+		// The SDK makes three retries, except for 503 and 410, which it
+		// retries only in another region and the fake has one.
+		{FaultThrottle, 4, isThrottled, "429"},
+		{FaultUnavailable, 1, func(err error) bool { return statusCode(err) == http.StatusServiceUnavailable }, "503"},
+		{FaultGone, 1, func(err error) bool { return statusCode(err) == http.StatusGone }, "410"},
+		{FaultDrop, 4, func(err error) bool { return errors.Is(err, syscall.ECONNRESET) }, "connection reset"},
+		{FaultTruncate, 4, func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fault, func(t *testing.T) {
+			ctx := testContext(t)
+			store, sw := faultyStore(t, tt.fault+"=1,retry-after=1ms")
+			if err := store.Set(ctx, "k", []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+
+			sw.on.Store(true)
+			_, _, err := store.Get(ctx, "k")
+			if err == nil || !tt.check(err) {
+				t.Errorf("Get(k) error = %v, want %s", err, tt.want)
+			}
+			if got := sw.attempts.Load(); got != tt.attempts {
+				t.Errorf("Get(k) made %d attempts, want %d", got, tt.attempts)
+			}
+			if got := sw.faults.Injected()[tt.fault]; got != int(tt.attempts) {
+				t.Errorf("injected %d %s faults, want %d", got, tt.fault, tt.attempts)
+			}
+
+			// Where the SDK retries, it rides out a fault that is not on
+			// every request.
+			if tt.attempts == 1 {
+				return
+			}
+			sw.attempts.Store(0)
+			sw.faults = NewFaultTransport(transporterRoundTripper{http.DefaultClient}, FaultConfig{Seed: 1, Rates: map[string]float64{tt.fault: 0.25}, RetryAfter: time.Millisecond})
+			for range 20 {
+				if value, _, err := store.Get(ctx, "k"); err != nil || string(value) != "v" {
+					t.Fatalf("Get(k) with %s at a quarter of the requests = %q, %v; want v, nil", tt.fault, value, err)
+				}
+			}
+			if injected := sw.faults.Injected()[tt.fault]; int(sw.attempts.Load()) != 20+injected || injected == 0 {
+				t.Errorf("20 gets made %d attempts with %d faults injected, want one retry per fault", sw.attempts.Load(), injected)
+			}
+		})
+	}
+}
+
+func TestParseFaultConfig(t *testing.T) {
+	cfg, err := ParseFaultConfig("latency=uniform:10ms-20ms, 429=0.05,drop=0.01,retry-after=250ms,seed=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Seed != 7 || cfg.RetryAfter != 250*time.Millisecond || cfg.Rates[FaultThrottle] != 0.05 || cfg.Rates[FaultDrop] != 0.01 {
+		t.Errorf("ParseFaultConfig = %+v", cfg)
+	}
+	if cfg.Latency != (UniformLatency{Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}) {
+		t.Errorf("latency = %#v, want uniform 10ms-20ms", cfg.Latency)
+	}
+
+	for _, tt := range []struct{ spec, err string }{
+		{"429", "expected name=value"},
+		{"429=1.5", "rate must be between 0 and 1"},
+		{"503=-0.1", "rate must be between 0 and 1"},
+		{"410=often", "invalid syntax"},
+		{"500=0.1", "unknown fault"},
+		{"seed=-1", "invalid syntax"},
+		{"retry-after=soon", "invalid duration"},
+		{"latency=fixed", `invalid duration ""`},
+		{"latency=fixed:-5ms", "invalid duration"},
+		{"latency=uniform:20ms-10ms", "max is below min"},
+		{"latency=normal:50ms", "expected 2 durations"},
+		{"latency=pareto:1ms", "unknown latency distribution"},
+		{"429=0.1,,drop=0.1", "expected name=value"},
+	} {
+		if _, err := ParseFaultConfig(tt.spec); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseFaultConfig(%q) error = %v, want %q", tt.spec, err, tt.err)
+		}
+	}
+}
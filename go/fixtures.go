@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// newFixtureStoreID returns a store id that is unique to this run, so fixtures
+// never collide with other runs or with real data in a shared container.
+func newFixtureStoreID() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("bench/%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(suffix))
+}
+
+// fixtureValue returns the deterministic value of the i-th key of space.
+func fixtureValue(space KeySpace, i, size int) []byte {
+	rng := mrand.New(mrand.NewPCG(space.Seed, uint64(i)))
+	value := make([]byte, size)
+	for j := range value {
+		value[j] = byte(rng.Uint32())
+	}
+	return value
+}
+
+// seedFixtures writes every key of space to the store, bounding each write by
+// opTimeout. A write that times out is retried once, so that one slow request
+// does not abort a run.
+func seedFixtures(ctx context.Context, store *KeyValueStore, space KeySpace, valueSize, concurrency int, opTimeout time.Duration) error {
+	// write reports whether the write timed out, as opposed to failing or
+	// being cut short by ctx.
+	write := func(key string, value []byte) (timedOut bool, err error) {
+		opCtx, cancel := opContext(ctx, opTimeout)
+		defer cancel()
+		err = store.Set(opCtx, key, value)
+		return err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded), err
+	}
+	return forEachIndex(ctx, space.Size, concurrency, func(i int) error {
+		key, value := space.Key(i), fixtureValue(space, i, valueSize)
+		timedOut, err := write(key, value)
+		if timedOut {
+			timedOut, err = write(key, value)
+		}
+		switch {
+		case timedOut:
+			return fmt.Errorf("write %s: timed out twice after %s", key, opTimeout)
+		case err != nil:
+			return fmt.Errorf("write %s: %w", key, err)
+		}
+		return nil
+	})
+}
+
+// verifyFixtures checks that the store holds exactly the keys of space,
+// bounding each page of the listing by opTimeout.
+func verifyFixtures(ctx context.Context, store *KeyValueStore, space KeySpace, opTimeout time.Duration) error {
+	keys, err := store.getKeys(ctx, opTimeout)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		present[key] = struct{}{}
+	}
+	missing := 0
+	for _, key := range space.Keys() {
+		if _, ok := present[key]; !ok {
+			missing++
+		}
+	}
+	if missing > 0 || len(keys) != space.Size {
+		return fmt.Errorf("store %s holds %d keys, %d of the %d fixtures are missing", store.StoreID(), len(keys), missing, space.Size)
+	}
+	return nil
+}
+
+// maxTeardownErrors is the most failed deletes teardownFixtures reports.
+const maxTeardownErrors = 5
+
+// teardownFixtures deletes every key of the store, including keys left over
+// from an interrupted seed. opTimeout bounds each page of the listing and each
+// delete. A failed delete does not stop the others; the error counts the keys
+// left behind.
+func teardownFixtures(ctx context.Context, store *KeyValueStore, concurrency int, opTimeout time.Duration) error {
+	keys, err := store.getKeys(ctx, opTimeout)
+	if err != nil {
+		return fmt.Errorf("list keys: %w", err)
+	}
+	var (
+		mu      sync.Mutex
+		deleted int
+		errs    []error
+	)
+	err = forEachIndex(ctx, len(keys), concurrency, func(i int) error {
+		opCtx, cancel := opContext(ctx, opTimeout)
+		defer cancel()
+		err := store.Delete(opCtx, keys[i])
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err == nil:
+			deleted++
+		case len(errs) < maxTeardownErrors:
+			errs = append(errs, fmt.Errorf("delete %s: %w", keys[i], err))
+		}
+		return nil
+	})
+	// forEachIndex only fails once ctx is done, leaving keys untried.
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if left := len(keys) - deleted; left > 0 {
+		return fmt.Errorf("%d of %d keys left: %w", left, len(keys), errors.Join(errs...))
+	}
+	return nil
+}
+
+// forEachIndex calls fn for 0..n-1 on up to concurrency goroutines. It stops
+// handing out work once ctx is done or fn fails, and returns the first error.
+func forEachIndex(ctx context.Context, n, concurrency int, fn func(i int) error) error {
+	var (
+		mu       sync.Mutex
+		next     int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	claim := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = ctx.Err()
+		}
+		if firstErr != nil || next >= n {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for range max(concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := claim()
+				if !ok {
+					return
+				}
+				if err := fn(i); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// failingDeletes fails the deletes of the items it names with 503 Service
+// Unavailable, which the SDK does not retry against a single region.
+type failingDeletes map[string]bool
+
+func (f failingDeletes) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete && f[req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]] {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(`{"code":"ServiceUnavailable"}`)),
+			Request:    req,
+		}, nil
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestTeardownFixturesPagesUnderOpTimeout(t *testing.T) {
+	ctx := testContext(t)
+	store, sw := faultyStore(t, "latency=fixed:30ms")
+	// The fake returns 100 keys a page, so listing these takes three pages
+	// and longer than the timeout of one request.
+	space := KeySpace{Seed: 1, Size: 250}
+	if err := seedFixtures(ctx, store, space, 16, 8, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	sw.on.Store(true)
+	const opTimeout = 60 * time.Millisecond
+	if err := verifyFixtures(ctx, store, space, opTimeout); err != nil {
+		t.Errorf("verifyFixtures: %v", err)
+	}
+	if err := teardownFixtures(ctx, store, 8, opTimeout); err != nil {
+		t.Errorf("teardownFixtures: %v", err)
+	}
+	sw.on.Store(false)
+	if keys, err := store.GetKeys(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("keys after teardown = %d, %v; want none", len(keys), err)
+	}
+}
+
+func TestTeardownFixturesContinuesAfterFailures(t *testing.T) {
+	ctx := testContext(t)
+	failing := failingDeletes{}
+	container := fakeClient(t, fakeServer(t, nil, "test"), "test", &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: failing}})
+	store := NewKeyValueStore(container, "teardown")
+	space := KeySpace{Seed: 1, Size: 20}
+	if err := seedFixtures(ctx, store, space, 16, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range space.Keys()[:maxTeardownErrors+2] {
+		failing[key] = true
+	}
+
+	err := teardownFixtures(ctx, store, 1, time.Second)
+	want := fmt.Sprintf("%d of 20 keys left", maxTeardownErrors+2)
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("teardownFixtures error = %v, want one starting %q", err, want)
+	}
+	// The error names the first failed deletes only.
+	if n := strings.Count(err.Error(), "delete k"); n != maxTeardownErrors {
+		t.Errorf("error names %d failed deletes, want %d:\n%v", n, maxTeardownErrors, err)
+	}
+	keys, err := store.GetKeys(ctx)
+	if err != nil || len(keys) != maxTeardownErrors+2 {
+		t.Errorf("keys after a failed teardown = %q, %v; want the %d that failed", keys, err, maxTeardownErrors+2)
+	}
+
+	clear(failing)
+	if err := teardownFixtures(ctx, store, 1, time.Second); err != nil {
+		t.Errorf("second teardown: %v", err)
+	}
+	if keys, err := store.GetKeys(ctx); err != nil || len(keys) != 0 {
+		t.Errorf("keys after the second teardown = %q, %v; want none", keys, err)
+	}
+}
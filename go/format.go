@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Output formats of query results.
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatTable  = "table"
+)
+
+// maxCellWidth is the most characters of a value shown in a table cell.
+const maxCellWidth = 48
+
+// resultWriter prints query results as they arrive.
+type resultWriter interface {
+	write(item []byte) error
+	// flush prints anything buffered. It is called once, after the last
+	// item.
+	flush() error
+}
+
+func newResultWriter(format string, w io.Writer) (resultWriter, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w}, nil
+	case FormatTable:
+		return &tableWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// jsonWriter prints results as an indented JSON array.
+type jsonWriter struct {
+	w io.Writer
+	n int
+}
+
+func (j *jsonWriter) write(item []byte) error {
+	var buf bytes.Buffer
+	if j.n == 0 {
+		buf.WriteString("[\n  ")
+	} else {
+		buf.WriteString(",\n  ")
+	}
+	if err := json.Indent(&buf, item, "  ", "  "); err != nil {
+		return fmt.Errorf("format result: %w", err)
+	}
+	j.n++
+	_, err := j.w.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonWriter) flush() error {
+	end := "\n]\n"
+	if j.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonWriter prints each result as a line of JSON.
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) write(item []byte) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, item); err != nil {
+		return fmt.Errorf("format result: %w", err)
+	}
+	buf.WriteByte('\n')
+	_, err := n.w.Write(buf.Bytes())
+	return err
+}
+
+func (n *ndjsonWriter) flush() error { return nil }
+
+// tableWriter prints results as an aligned table with a column per property,
+// in the order the properties first appear. Results that are not objects,
+// such as those of SELECT VALUE, go in a column of their own.
+type tableWriter struct {
+	w       io.Writer
+	columns []string
+	rows    []map[string]json.RawMessage
+}
+
+// valueColumn is the column of results that are not objects.
+const valueColumn = "(value)"
+
+func (t *tableWriter) write(item []byte) error {
+	keys, values, ok := objectMembers(item)
+	if !ok {
+		keys, values = []string{valueColumn}, map[string]json.RawMessage{valueColumn: item}
+	}
+	for _, key := range keys {
+		if !slices.Contains(t.columns, key) {
+			t.columns = append(t.columns, key)
+		}
+	}
+	t.rows = append(t.rows, values)
+	return nil
+}
+
+func (t *tableWriter) flush() error {
+	if len(t.rows) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(t.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.columns, "\t"))
+	cells := make([]string, len(t.columns))
+	for _, row := range t.rows {
+		for i, column := range t.columns {
+			cells[i] = cell(row[column])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// objectMembers returns the members of a JSON object in order. ok is false if
+// item is not an object.
+func objectMembers(item []byte) (keys []string, values map[string]json.RawMessage, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(item))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, false
+	}
+	values = map[string]json.RawMessage{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, false
+		}
+		keys = append(keys, key)
+		values[key] = value
+	}
+	return keys, values, true
+}
+
+// cell formats a value for a table: strings unquoted, anything else as
+// compact JSON, and missing values empty. Long values are truncated.
+func cell(value json.RawMessage) string {
+	if value == nil {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		var buf bytes.Buffer
+		json.Compact(&buf, value)
+		s = buf.String()
+	}
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+	if utf8.RuneCountInString(s) > maxCellWidth {
+		s = string([]rune(s)[:maxCellWidth-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// formatResults prints items with the result writer of format.
+func formatResults(t *testing.T, format string, items ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newResultWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if err := w.write([]byte(item)); err != nil {
+			t.Fatalf("write(%s): %v", item, err)
+		}
+	}
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestResultWriters(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	tests := []struct {
+		format string
+		items  []string
+		want   string
+	}{
+		{FormatJSON, nil, "[]\n"},
+		{FormatJSON, []string{`{"id":"a","n":1}`}, "[\n  {\n    \"id\": \"a\",\n    \"n\": 1\n  }\n]\n"},
+		{FormatJSON, []string{`"a"`, `{"tags": ["x"]}`}, "[\n  \"a\",\n  {\n    \"tags\": [\n      \"x\"\n    ]\n  }\n]\n"},
+		{FormatNDJSON, nil, ""},
+		{FormatNDJSON, []string{"{\"id\": \"a\",\n \"n\": [1, 2]}", `"b"`}, "{\"id\":\"a\",\"n\":[1,2]}\n\"b\"\n"},
+		{FormatTable, nil, ""},
+		// Columns appear in the order the properties first do, and a
+		// property an item lacks leaves its cell empty.
+		{FormatTable, []string{`{"id":"a","n":1}`, `{"n":2,"tags":["x"],"id":"bb"}`, `{"id":"c"}`},
+			"id  n  tags\n" +
+				"a   1  \n" +
+				"bb  2  [\"x\"]\n" +
+				"c      \n"},
+		// Results that are not objects go in a column of their own.
+		{FormatTable, []string{`"a"`, `5`, `{"id":"b"}`},
+			"(value)  id\n" +
+				"a        \n" +
+				"5        \n" +
+				"         b\n"},
+		// Long values are truncated and line breaks flattened.
+		{FormatTable, []string{`{"v":"` + long + `"}`, `{"v":"a\nb"}`},
+			"v\n" +
+				strings.Repeat("x", maxCellWidth-1) + "…\n" +
+				"a b\n"},
+	}
+	for _, tt := range tests {
+		if got := formatResults(t, tt.format, tt.items...); got != tt.want {
+			t.Errorf("%s of %q:\n%s\nwant:\n%s", tt.format, tt.items, got, tt.want)
+		}
+	}
+}
+
+func TestResultWriterErrors(t *testing.T) {
+	if _, err := newResultWriter("yaml", &bytes.Buffer{}); err == nil {
+		t.Error("newResultWriter(yaml) succeeded")
+	}
+	for _, format := range []string{FormatJSON, FormatNDJSON} {
+		w, _ := newResultWriter(format, &bytes.Buffer{})
+		if err := w.write([]byte(`{"id":`)); err == nil {
+			t.Errorf("%s: write of malformed JSON succeeded", format)
+		}
+	}
+}
@@ -2,11 +2,14 @@ module example/cosmos
 
 go 1.23.4
 
-require github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos v1.3.0
+require (
+	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.16.0
+	github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos v1.3.0
+	golang.org/x/sys v0.28.0
+)
 
 require (
 	github.com/Azure/azure-sdk-for-go v68.0.0+incompatible // indirect
-	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.16.0 // indirect
 	github.com/Azure/azure-sdk-for-go/sdk/internal v1.10.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// Supported key distributions.
+const (
+	DistributionUniform    = "uniform"
+	DistributionZipfian    = "zipfian"
+	DistributionHotspot    = "hotspot"
+	DistributionSequential = "sequential"
+	DistributionLatest     = "latest"
+)
+
+const (
+	// zipfianTheta is the skew used by YCSB's zipfian generator.
+	zipfianTheta = 0.99
+	// hotspotKeyFraction of the key space receives hotspotOpFraction of the operations.
+	hotspotKeyFraction = 0.2
+	hotspotOpFraction  = 0.8
+)
+
+// KeySpace is a deterministic set of Size keys derived from Seed.
+//
+// Key names are scattered rather than sequential so that hot keys of a skewed
+// distribution are not clustered together in the index.
+type KeySpace struct {
+	Seed uint64
+	Size int
+}
+
+// Key returns the i-th key of the space, where 0 is the first inserted key.
+func (s KeySpace) Key(i int) string {
+	return fmt.Sprintf("k%016x", splitmix64(s.Seed+uint64(i)))
+}
+
+// Keys returns every key of the space in insertion order.
+func (s KeySpace) Keys() []string {
+	keys := make([]string, s.Size)
+	for i := range keys {
+		keys[i] = s.Key(i)
+	}
+	return keys
+}
+
+// splitmix64 is a bijective mixing function, so distinct inputs never collide.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// KeyGenerator picks keys from a KeySpace following a distribution. The same
+// seed always yields the same sequence of keys. It is safe for concurrent use;
+// concurrent callers share one sequence.
+type KeyGenerator struct {
+	mu    sync.Mutex
+	space KeySpace
+	rng   *rand.Rand
+	next  func(r *rand.Rand) int
+}
+
+// NewKeyGenerator returns a generator over space for the named distribution.
+func NewKeyGenerator(distribution string, space KeySpace, seed uint64) (*KeyGenerator, error) {
+	if space.Size <= 0 {
+		return nil, fmt.Errorf("key space must not be empty")
+	}
+	n := space.Size
+	g := &KeyGenerator{
+		space: space,
+		rng:   rand.New(rand.NewPCG(seed, splitmix64(seed))),
+	}
+	switch distribution {
+	case DistributionUniform:
+		g.next = func(r *rand.Rand) int { return r.IntN(n) }
+	case DistributionZipfian:
+		z := newZipfian(n)
+		g.next = z.next
+	case DistributionLatest:
+		// Most recently inserted keys are the most popular.
+		z := newZipfian(n)
+		g.next = func(r *rand.Rand) int { return n - 1 - z.next(r) }
+	case DistributionHotspot:
+		hot := max(1, int(float64(n)*hotspotKeyFraction))
+		g.next = func(r *rand.Rand) int {
+			if hot == n || r.Float64() < hotspotOpFraction {
+				return r.IntN(hot)
+			}
+			return hot + r.IntN(n-hot)
+		}
+	case DistributionSequential:
+		i := 0
+		g.next = func(*rand.Rand) int {
+			k := i
+			i = (i + 1) % n
+			return k
+		}
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", distribution)
+	}
+	return g, nil
+}
+
+// Next returns the next key.
+func (g *KeyGenerator) Next() string {
+	g.mu.Lock()
+	i := g.next(g.rng)
+	g.mu.Unlock()
+	return g.space.Key(i)
+}
+
+// zipfian draws ranks in [0, n) where rank 0 is the most popular, using the
+// algorithm from Gray et al., "Quickly Generating Billion-Record Synthetic
+// Databases", as popularised by YCSB.
+type zipfian struct {
+	n     int
+	alpha float64
+	zetan float64
+	eta   float64
+	half  float64
+}
+
+func newZipfian(n int) *zipfian {
+	zetan := 0.0
+	for i := 1; i <= n; i++ {
+		zetan += 1 / math.Pow(float64(i), zipfianTheta)
+	}
+	zeta2 := 1 + math.Pow(0.5, zipfianTheta)
+	return &zipfian{
+		n:     n,
+		alpha: 1 / (1 - zipfianTheta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-zipfianTheta)) / (1 - zeta2/zetan),
+		half:  math.Pow(0.5, zipfianTheta),
+	}
+}
+
+func (z *zipfian) next(r *rand.Rand) int {
+	u := r.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1+z.half {
+		return min(1, z.n-1)
+	}
+	rank := int(float64(z.n) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	return min(rank, z.n-1)
+}
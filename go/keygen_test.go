@@ -0,0 +1,144 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+var distributions = []string{DistributionUniform, DistributionZipfian, DistributionHotspot, DistributionSequential, DistributionLatest}
+
+// drawKeys returns n keys of a generator for distribution over space.
+func drawKeys(t *testing.T, distribution string, space KeySpace, seed uint64, n int) []string {
+	t.Helper()
+	g, err := NewKeyGenerator(distribution, space, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = g.Next()
+	}
+	return keys
+}
+
+// rankCounts draws n keys and counts how often each index of the space came
+// up.
+func rankCounts(t *testing.T, distribution string, space KeySpace, n int) []int {
+	t.Helper()
+	index := map[string]int{}
+	for i, key := range space.Keys() {
+		index[key] = i
+	}
+	counts := make([]int, space.Size)
+	for _, key := range drawKeys(t, distribution, space, 1, n) {
+		i, ok := index[key]
+		if !ok {
+			t.Fatalf("%s: key %s is not in the key space", distribution, key)
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+func TestKeySpace(t *testing.T) {
+	space := KeySpace{Seed: 7, Size: 1000}
+	keys := space.Keys()
+	if got := len(slices.Compact(slices.Sorted(slices.Values(keys)))); got != space.Size {
+		t.Errorf("key space of %d has %d distinct keys", space.Size, got)
+	}
+	if other := (KeySpace{Seed: 8, Size: 1000}).Keys(); slices.Equal(keys, other) {
+		t.Error("key spaces of different seeds are equal")
+	}
+}
+
+func TestKeyGeneratorDeterministic(t *testing.T) {
+	space := KeySpace{Seed: 1, Size: 100}
+	for _, distribution := range distributions {
+		a := drawKeys(t, distribution, space, 42, 200)
+		if b := drawKeys(t, distribution, space, 42, 200); !slices.Equal(a, b) {
+			t.Errorf("%s: two generators of seed 42 gave different sequences", distribution)
+		}
+		if distribution == DistributionSequential {
+			continue
+		}
+		if c := drawKeys(t, distribution, space, 43, 200); slices.Equal(a, c) {
+			t.Errorf("%s: seeds 42 and 43 gave the same sequence", distribution)
+		}
+	}
+}
+
+func TestKeyGeneratorSequential(t *testing.T) {
+	space := KeySpace{Seed: 1, Size: 3}
+	keys := space.Keys()
+	want := append(append(slices.Clone(keys), keys...), keys[0])
+	if got := drawKeys(t, DistributionSequential, space, 1, 7); !slices.Equal(got, want) {
+		t.Errorf("sequential keys = %q, want %q", got, want)
+	}
+}
+
+func TestKeyGeneratorSkew(t *testing.T) {
+	const draws = 100_000
+	space := KeySpace{Seed: 1, Size: 1000}
+	// share returns the fraction of draws that fell on the indexes [from, to).
+	share := func(counts []int, from, to int) float64 {
+		n := 0
+		for _, c := range counts[from:to] {
+			n += c
+		}
+		return float64(n) / draws
+	}
+	tests := []struct {
+		distribution string
+		from, to     int
+		min, max     float64
+	}{
+		// 80% of reads go to the first 20% of keys.
+		{DistributionHotspot, 0, 200, 0.78, 0.82},
+		// A uniform tenth of the keys gets a tenth of the reads.
+		{DistributionUniform, 0, 100, 0.09, 0.11},
+		// The most popular keys of zipfian are the first inserted, those of
+		// latest the last: the top 1% gets over a third of the reads.
+		{DistributionZipfian, 0, 10, 0.35, 1},
+		{DistributionZipfian, 990, 1000, 0, 0.01},
+		{DistributionLatest, 990, 1000, 0.35, 1},
+		{DistributionLatest, 0, 10, 0, 0.01},
+	}
+	for _, tt := range tests {
+		counts := rankCounts(t, tt.distribution, space, draws)
+		if got := share(counts, tt.from, tt.to); got < tt.min || got > tt.max {
+			t.Errorf("%s: keys [%d, %d) got %.3f of reads, want %.2f to %.2f", tt.distribution, tt.from, tt.to, got, tt.min, tt.max)
+		}
+	}
+
+	// Zipfian popularity falls with rank.
+	counts := rankCounts(t, DistributionZipfian, space, draws)
+	if !(counts[0] > counts[1] && counts[1] > counts[10] && counts[10] > counts[100]) {
+		t.Errorf("zipfian counts of ranks 0, 1, 10 and 100 = %d, %d, %d, %d; want decreasing", counts[0], counts[1], counts[10], counts[100])
+	}
+}
+
+func TestKeyGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		distribution string
+		size         int
+	}{
+		{"pareto", 10},
+		{"", 10},
+		{DistributionUniform, 0},
+		{DistributionZipfian, -1},
+	}
+	for _, tt := range tests {
+		if _, err := NewKeyGenerator(tt.distribution, KeySpace{Seed: 1, Size: tt.size}, 1); err == nil {
+			t.Errorf("NewKeyGenerator(%q) over %d keys succeeded", tt.distribution, tt.size)
+		}
+	}
+	// Every distribution works over a single key.
+	space := KeySpace{Seed: 1, Size: 1}
+	for _, distribution := range distributions {
+		for _, key := range drawKeys(t, distribution, space, 1, 10) {
+			if key != space.Key(0) {
+				t.Errorf("%s over one key returned %s", distribution, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxHistory is the most lines the line editor remembers.
+const maxHistory = 1000
+
+// maxListedCompletions is the most completion candidates listed at once.
+const maxListedCompletions = 100
+
+// errInterrupted is returned by readLine when the line is abandoned with
+// Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// completer returns the candidates for word, the word being typed, given the
+// words before it.
+type completer func(args []string, word string) []string
+
+// lineEditor reads lines from a terminal with Emacs-style editing, history and
+// tab completion. If standard input or output is not a terminal, it reads
+// plain lines without a prompt.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	terminal bool
+	history  []string
+	complete completer
+}
+
+func newLineEditor(in, out *os.File, complete completer) *lineEditor {
+	return &lineEditor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		fd:       int(in.Fd()),
+		terminal: isTerminal(int(in.Fd())) && isTerminal(int(out.Fd())),
+		complete: complete,
+	}
+}
+
+// addHistory appends line to the history, unless it is empty or repeats the
+// previous line, and reports whether it did.
+func (e *lineEditor) addHistory(line string) bool {
+	if line == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return false
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = slices.Delete(e.history, 0, len(e.history)-maxHistory)
+	}
+	return true
+}
+
+// readLine reads a line. It returns io.EOF at the end of the input or on
+// Ctrl-D at an empty line, and errInterrupted on Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	l := &editedLine{prompt: prompt, hist: len(e.history)}
+	e.refresh(l)
+	list := false
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := false
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(l.buf), nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(l.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			l.deleteForward()
+		case ctrl('A'):
+			l.pos = 0
+		case ctrl('E'):
+			l.pos = len(l.buf)
+		case ctrl('B'):
+			l.left()
+		case ctrl('F'):
+			l.right()
+		case ctrl('H'), 0x7f:
+			l.deleteBackward()
+		case ctrl('K'):
+			l.buf = l.buf[:l.pos]
+		case ctrl('U'):
+			l.buf = slices.Delete(l.buf, 0, l.pos)
+			l.pos = 0
+		case ctrl('W'):
+			l.deleteWord()
+		case ctrl('P'):
+			e.recall(l, -1)
+		case ctrl('N'):
+			e.recall(l, 1)
+		case '\t':
+			tab = true
+			list = e.completeWord(l, list)
+		case 0x1b:
+			e.escape(l)
+		default:
+			if r >= ' ' {
+				l.insert(r)
+			}
+		}
+		if !tab {
+			list = false
+		}
+		e.refresh(l)
+	}
+}
+
+// ctrl returns the character typed by Ctrl and key.
+func ctrl(key rune) rune { return key & 0x1f }
+
+// escape handles an escape sequence, as sent by the arrow, Home, End and
+// Delete keys.
+func (e *lineEditor) escape(l *editedLine) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	// Sequences like ESC [ 3 ~ carry a number before the final character.
+	var param strings.Builder
+	for r >= '0' && r <= '9' || r == ';' {
+		param.WriteRune(r)
+		if r, _, err = e.in.ReadRune(); err != nil {
+			return
+		}
+	}
+	switch {
+	case r == 'A':
+		e.recall(l, -1)
+	case r == 'B':
+		e.recall(l, 1)
+	case r == 'C':
+		l.right()
+	case r == 'D':
+		l.left()
+	case r == 'H', r == '~' && (param.String() == "1" || param.String() == "7"):
+		l.pos = 0
+	case r == 'F', r == '~' && (param.String() == "4" || param.String() == "8"):
+		l.pos = len(l.buf)
+	case r == '~' && param.String() == "3":
+		l.deleteForward()
+	}
+}
+
+// recall replaces the line with the previous (dir -1) or next (dir 1) line of
+// the history. The line being typed is kept while browsing.
+func (e *lineEditor) recall(l *editedLine, dir int) {
+	next := l.hist + dir
+	if next < 0 || next > len(e.history) {
+		return
+	}
+	if l.hist == len(e.history) {
+		l.typed = slices.Clone(l.buf)
+	}
+	l.hist = next
+	if next == len(e.history) {
+		l.buf = l.typed
+	} else {
+		l.buf = []rune(e.history[next])
+	}
+	l.pos = len(l.buf)
+}
+
+// completeWord completes the word before the cursor: fully if there is one
+// candidate, otherwise up to their common prefix. If that does not extend the
+// word, a second tab lists the candidates. It reports whether the next tab
+// should list them.
+func (e *lineEditor) completeWord(l *editedLine, list bool) bool {
+	if e.complete == nil {
+		return false
+	}
+	before := l.buf[:l.pos]
+	start := len(before)
+	for start > 0 && before[start-1] != ' ' {
+		start--
+	}
+	args, err := splitWords(string(before[:start]))
+	if err != nil {
+		return false
+	}
+	word := string(before[start:])
+	candidates := e.complete(args, word)
+	if len(candidates) == 0 {
+		return false
+	}
+	completion := candidates[0]
+	if len(candidates) == 1 {
+		completion += " "
+	} else {
+		for _, c := range candidates[1:] {
+			completion = commonPrefix(completion, c)
+		}
+	}
+	if completion != word {
+		l.buf = slices.Concat(l.buf[:start], []rune(completion), l.buf[l.pos:])
+		l.pos = start + len([]rune(completion))
+		return false
+	}
+	if !list {
+		return true
+	}
+	var b strings.Builder
+	b.WriteString("\r\n")
+	for i, c := range candidates {
+		if i == maxListedCompletions {
+			fmt.Fprintf(&b, "... and %d more", len(candidates)-i)
+			break
+		}
+		b.WriteString(c)
+		b.WriteString("  ")
+	}
+	b.WriteString("\r\n")
+	io.WriteString(e.out, b.String())
+	return false
+}
+
+func commonPrefix(a, b string) string {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return string(ra[:n])
+}
+
+// refresh redraws the line and places the cursor.
+func (e *lineEditor) refresh(l *editedLine) {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(l.prompt)
+	b.WriteString(string(l.buf))
+	b.WriteString("\x1b[K")
+	if n := len(l.buf) - l.pos; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", n)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+// editedLine is the state of the line being edited.
+type editedLine struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// hist is the index of the history line shown, or len(history) for
+	// the line being typed, which typed keeps while browsing.
+	hist  int
+	typed []rune
+}
+
+func (l *editedLine) insert(r rune) {
+	l.buf = slices.Insert(l.buf, l.pos, r)
+	l.pos++
+}
+
+func (l *editedLine) left() {
+	if l.pos > 0 {
+		l.pos--
+	}
+}
+
+func (l *editedLine) right() {
+	if l.pos < len(l.buf) {
+		l.pos++
+	}
+}
+
+func (l *editedLine) deleteBackward() {
+	if l.pos > 0 {
+		l.buf = slices.Delete(l.buf, l.pos-1, l.pos)
+		l.pos--
+	}
+}
+
+func (l *editedLine) deleteForward() {
+	if l.pos < len(l.buf) {
+		l.buf = slices.Delete(l.buf, l.pos, l.pos+1)
+	}
+}
+
+// deleteWord deletes the word before the cursor and the spaces after it.
+func (l *editedLine) deleteWord() {
+	start := l.pos
+	for start > 0 && l.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && l.buf[start-1] != ' ' {
+		start--
+	}
+	l.buf = slices.Delete(l.buf, start, l.pos)
+	l.pos = start
+}
+
+// splitWords splits a line into words at spaces. Quotes group words as in a
+// POSIX shell: nothing is special within single quotes, and a backslash
+// escapes the next character outside quotes, or a double quote or backslash
+// within double quotes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	for {
+		word, rest, ok, err := nextWord(line)
+		if err != nil || !ok {
+			return words, err
+		}
+		words = append(words, word)
+		line = rest
+	}
+}
+
+// nextWord returns the first word of s and what follows it. ok is false if s
+// has no words.
+func nextWord(s string) (word, rest string, ok bool, err error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return "", "", false, nil
+	}
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				b.WriteByte(c)
+			}
+		case c == '\\' && i+1 < len(s) && (quote == 0 || s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			b.WriteByte(s[i])
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				b.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t':
+			return b.String(), s[i:], true, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if quote != 0 {
+		return "", "", false, fmt.Errorf("unterminated %c quote", quote)
+	}
+	return b.String(), "", true, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  \t ", nil},
+		{"get key", []string{"get", "key"}},
+		{"  set \t a  b  ", []string{"set", "a", "b"}},
+		{`set k 'a b'`, []string{"set", "k", "a b"}},
+		{`set k "a b"`, []string{"set", "k", "a b"}},
+		// Quoted and unquoted parts of a word join up.
+		{`set k a'b c'd`, []string{"set", "k", "ab cd"}},
+		{`set '' ""`, []string{"set", "", ""}},
+		// Nothing is special within single quotes.
+		{`set k '\ "x"'`, []string{"set", "k", `\ "x"`}},
+		// Within double quotes only a quote or backslash is escaped.
+		{`set k "say \"hi\" \\ \n"`, []string{"set", "k", `say "hi" \ \n`}},
+		{`set k "it's"`, []string{"set", "k", "it's"}},
+		// Outside quotes a backslash escapes any character.
+		{`set a\ b \'c\'`, []string{"set", "a b", "'c'"}},
+		{`set k a\`, []string{"set", "k", `a\`}},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.line)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+
+	for _, line := range []string{`set k 'a b`, `set k "a b`, `set k "a\"`, `'`} {
+		if got, err := splitWords(line); err == nil || !strings.HasPrefix(err.Error(), "unterminated") {
+			t.Errorf("splitWords(%q) = %q, %v; want an unterminated quote error", line, got, err)
+		}
+	}
+}
+
+func TestNextWord(t *testing.T) {
+	// The rest of the line is returned as typed, quotes and all.
+	word, rest, ok, err := nextWord(`  query -pk "a b" SELECT * FROM c WHERE c.id = 'x'`)
+	if word != "query" || rest != ` -pk "a b" SELECT * FROM c WHERE c.id = 'x'` || !ok || err != nil {
+		t.Errorf("nextWord = %q, %q, %v, %v", word, rest, ok, err)
+	}
+	if word, rest, ok, err := nextWord(" \t"); word != "" || rest != "" || ok || err != nil {
+		t.Errorf("nextWord of spaces = %q, %q, %v, %v; want no word", word, rest, ok, err)
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	ed := &lineEditor{}
+	for _, line := range []string{"a", "", "b", "b", "a"} {
+		ed.addHistory(line)
+	}
+	if want := []string{"a", "b", "a"}; !slices.Equal(ed.history, want) {
+		t.Errorf("history = %q, want %q", ed.history, want)
+	}
+
+	ed = &lineEditor{}
+	for i := range maxHistory + 10 {
+		ed.addHistory(fmt.Sprint(i))
+	}
+	if len(ed.history) != maxHistory || ed.history[0] != "10" || ed.history[maxHistory-1] != fmt.Sprint(maxHistory+9) {
+		t.Errorf("history of %d lines kept %d, from %s to %s; want the last %d", maxHistory+10, len(ed.history), ed.history[0], ed.history[len(ed.history)-1], maxHistory)
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	// load returns the history of a new editor loaded from path, and the
+	// file to append to.
+	load := func() (*lineEditor, *os.File) {
+		t.Helper()
+		ed := &lineEditor{}
+		f, err := loadHistory(path, ed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return ed, f
+	}
+
+	// A missing file is created.
+	ed, f := load()
+	if len(ed.history) != 0 {
+		t.Errorf("history of a missing file = %q", ed.history)
+	}
+	for _, line := range []string{"get a", "keys"} {
+		fmt.Fprintln(f, line)
+	}
+	f.Close()
+	if ed, _ := load(); !slices.Equal(ed.history, []string{"get a", "keys"}) {
+		t.Errorf("history read back = %q", ed.history)
+	}
+
+	// A file longer than the history kept is trimmed to its last lines.
+	var lines []string
+	for i := range maxHistory + 5 {
+		lines = append(lines, fmt.Sprintf("get k%d", i))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ed, f = load()
+	if !slices.Equal(ed.history, lines[5:]) {
+		t.Errorf("history of %d lines has %d, starting %q", len(lines), len(ed.history), ed.history[0])
+	}
+	fmt.Fprintln(f, "exists a")
+	f.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(append(lines[5:], "exists a"), "\n") + "\n"; string(data) != want {
+		t.Errorf("trimmed file has %d lines, want %d", strings.Count(string(data), "\n"), maxHistory+1)
+	}
+}
+
+func TestEditedLine(t *testing.T) {
+	l := &editedLine{}
+	for _, r := range "get  key" {
+		l.insert(r)
+	}
+	l.deleteWord()
+	if string(l.buf) != "get  " || l.pos != 5 {
+		t.Errorf("after deleting a word: %q at %d", string(l.buf), l.pos)
+	}
+	// A word and the spaces after it go together.
+	l.deleteWord()
+	if string(l.buf) != "" || l.pos != 0 {
+		t.Errorf("after deleting another word: %q at %d", string(l.buf), l.pos)
+	}
+
+	ed := &lineEditor{history: []string{"get a", "keys"}}
+	l = &editedLine{buf: []rune("ex"), pos: 2, hist: 2}
+	for _, step := range []struct {
+		dir  int
+		want string
+	}{{-1, "keys"}, {-1, "get a"}, {-1, "get a"}, {1, "keys"}, {1, "ex"}, {1, "ex"}} {
+		ed.recall(l, step.dir)
+		if string(l.buf) != step.want || l.pos != len(l.buf) {
+			t.Fatalf("recall(%d) shows %q at %d, want %q at the end", step.dir, string(l.buf), l.pos, step.want)
+		}
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	words := []string{"get", "gets", "exists", "keys"}
+	ed := &lineEditor{
+		out: &strings.Builder{},
+		complete: func(args []string, word string) []string {
+			var matches []string
+			for _, w := range words {
+				if strings.HasPrefix(w, word) {
+					matches = append(matches, w)
+				}
+			}
+			return matches
+		},
+	}
+	tests := []struct {
+		line     string
+		pos      int
+		want     string
+		wantPos  int
+		wantList bool
+	}{
+		// One candidate completes and is followed by a space.
+		{"ex", 2, "exists ", 7, false},
+		{"use k", 5, "use keys ", 9, false},
+		// Several complete up to their common prefix, and a tab that
+		// adds nothing lists them next time.
+		{"ge", 2, "get", 3, false},
+		{"get", 3, "get", 3, true},
+		// Only the word before the cursor completes.
+		{"ex more", 2, "exists  more", 7, false},
+		{"zz", 2, "zz", 2, false},
+	}
+	for _, tt := range tests {
+		l := &editedLine{buf: []rune(tt.line), pos: tt.pos}
+		list := ed.completeWord(l, false)
+		if string(l.buf) != tt.want || l.pos != tt.wantPos || list != tt.wantList {
+			t.Errorf("completing %q at %d = %q at %d, list %v; want %q at %d, list %v", tt.line, tt.pos, string(l.buf), l.pos, list, tt.want, tt.wantPos, tt.wantList)
+		}
+	}
+
+	l := &editedLine{buf: []rune("get"), pos: 3}
+	ed.completeWord(l, true)
+	if got := ed.out.(*strings.Builder).String(); got != "\r\nget  gets  \r\n" {
+		t.Errorf("second tab listed %q", got)
+	}
+}
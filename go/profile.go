@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profiles names the pprof files captured while a benchmark measures. Empty
+// paths are not captured. The CPU profile covers the reads only, but the
+// allocation profile is cumulative: it counts every allocation since the
+// program started, including those of seeding the fixtures.
+type profiles struct {
+	CPU    string
+	Heap   string
+	Allocs string
+}
+
+// start begins CPU profiling. The returned function stops it and writes the
+// heap and allocation profiles.
+func (p profiles) start() (stop func() error, err error) {
+	var cpu *os.File
+	if p.CPU != "" {
+		if cpu, err = os.Create(p.CPU); err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("start CPU profile: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return err
+			}
+		}
+		if p.Heap != "" {
+			// Collect garbage first so the profile shows live objects only.
+			runtime.GC()
+			if err := writeProfile("heap", p.Heap); err != nil {
+				return err
+			}
+		}
+		if p.Allocs != "" {
+			if err := writeProfile("allocs", p.Allocs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s profile: %w", name, err)
+	}
+	return f.Close()
+}
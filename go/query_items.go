@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// QueryItems runs query in the partition pk and yields every result decoded
+// as T. Pages are fetched as the caller consumes them, so breaking out of the
+// loop stops fetching. A failed page, a decoding error or ctx being done is
+// yielded once as the error and ends the sequence.
+//
+//	for doc, err := range QueryItems[Document](ctx, client, query, pk, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func QueryItems[T any](ctx context.Context, client *azcosmos.ContainerClient, query string, pk azcosmos.PartitionKey, o *azcosmos.QueryOptions) iter.Seq2[T, error] {
+	return queryItems[T](ctx, client, query, pk, o, 0)
+}
+
+// queryItems is QueryItems with each page request bounded by pageTimeout, so
+// that a query of many pages is not cut short by a timeout meant for one
+// request. A zero pageTimeout leaves pages bounded only by ctx.
+func queryItems[T any](ctx context.Context, client *azcosmos.ContainerClient, query string, pk azcosmos.PartitionKey, o *azcosmos.QueryOptions, pageTimeout time.Duration) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		pager := client.NewQueryItemsPager(query, pk, o)
+		for pager.More() {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+			pageCtx, cancel := opContext(ctx, pageTimeout)
+			resp, err := pager.NextPage(pageCtx)
+			cancel()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range resp.Items {
+				var v T
+				if err := json.Unmarshal(item, &v); err != nil {
+					yield(zero, fmt.Errorf("decode query result: %w", err))
+					return
+				}
+				if !yield(v, nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+
+	"example/cosmos/fakecosmos"
+)
+
+// queryCounter counts the query requests it sends.
+type queryCounter struct {
+	queries atomic.Int32
+}
+
+func (c *queryCounter) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Content-Type") == "application/query+json" {
+		c.queries.Add(1)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// fakeServer starts a fake, closed when the test ends, with the container
+// items of the database db, partitioned on /store_id.
+func fakeServer(t *testing.T, o *fakecosmos.Options, db string) *fakecosmos.Server {
+	t.Helper()
+	srv := fakecosmos.NewServer(o)
+	t.Cleanup(srv.Close)
+	if err := srv.Account.CreateContainer(db, "items", "/store_id"); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// fakeClient returns a client of the container items of the database db of
+// srv. o may be nil.
+func fakeClient(t *testing.T, srv *fakecosmos.Server, db string, o *azcosmos.ClientOptions) *azcosmos.ContainerClient {
+	t.Helper()
+	container, err := srv.ContainerClient(db, "items", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return container
+}
+
+// fakeContainer returns a container of a new fake, partitioned on /store_id,
+// whose client counts the queries it sends.
+func fakeContainer(t *testing.T) (*azcosmos.ContainerClient, *queryCounter) {
+	t.Helper()
+	counter := &queryCounter{}
+	o := &azcosmos.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: counter}}
+	return fakeClient(t, fakeServer(t, nil, "test"), "test", o), counter
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestQueryItems(t *testing.T) {
+	ctx := testContext(t)
+	container, counter := fakeContainer(t)
+	store := NewKeyValueStore(container, "query")
+	var want []string
+	for i := range 10 {
+		key := fmt.Sprintf("k%02d", i)
+		if err := store.Set(ctx, key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, key)
+	}
+	query := "SELECT * FROM c ORDER BY c.id"
+	paged := func() *azcosmos.QueryOptions { return &azcosmos.QueryOptions{PageSizeHint: 2} }
+
+	t.Run("all pages", func(t *testing.T) {
+		counter.queries.Store(0)
+		var ids []string
+		for doc, err := range QueryItems[Document](ctx, container, query, store.pk, paged()) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, doc.ID)
+		}
+		if !slices.Equal(ids, want) {
+			t.Errorf("ids = %q, want %q", ids, want)
+		}
+		if got := counter.queries.Load(); got != 5 {
+			t.Errorf("10 items in pages of 2 took %d requests, want 5", got)
+		}
+	})
+
+	t.Run("early break", func(t *testing.T) {
+		counter.queries.Store(0)
+		n := 0
+		for _, err := range QueryItems[Document](ctx, container, query, store.pk, paged()) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n++; n == 3 {
+				break
+			}
+		}
+		if got := counter.queries.Load(); got != 2 {
+			t.Errorf("breaking after 3 items took %d requests, want 2", got)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		counter.queries.Store(0)
+		cancelled, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var ids []string
+		var errs []error
+		for doc, err := range QueryItems[Document](cancelled, container, query, store.pk, paged()) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, doc.ID)
+			cancel()
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+			t.Errorf("errors after cancelling = %v, want context.Canceled once", errs)
+		}
+		// The page being consumed is finished, but no other is fetched.
+		if !slices.Equal(ids, want[:2]) || counter.queries.Load() != 1 {
+			t.Errorf("cancelling after the first item yielded %q in %d requests, want %q in 1", ids, counter.queries.Load(), want[:2])
+		}
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		// k03 has a value that is not base64, so it cannot be decoded
+		// into Document.
+		bad := []byte(`{"id": "k03", "store_id": "query", "value": "not base64!"}`)
+		if _, err := container.UpsertItem(ctx, store.pk, bad, nil); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		var errs []error
+		for doc, err := range QueryItems[Document](ctx, container, query, store.pk, paged()) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, doc.ID)
+		}
+		if !slices.Equal(ids, want[:3]) {
+			t.Errorf("ids before the bad item = %q, want %q", ids, want[:3])
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), "decode query result") {
+			t.Errorf("errors = %v, want one decode error", errs)
+		}
+	})
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// shellCommand is a command of the interactive shell.
+type shellCommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(sh *shell, ctx context.Context, args []string) error
+	// keyArg is set if the first argument is a key, which tab completes.
+	keyArg bool
+	// remote is set if the command sends requests, so that its latency and
+	// request charge are worth reporting.
+	remote bool
+}
+
+var shellCommands = []shellCommand{
+	{"use", "<store_id>", "switch to another store", (*shell).use, false, false},
+	{"get", "<key>", "print the value of key", (*shell).get, true, true},
+	{"set", "<key> <value>", "set key to value", (*shell).set, true, true},
+	{"delete", "<key>", "delete key", (*shell).delete, true, true},
+	{"exists", "<key>", "report whether key exists", (*shell).exists, true, true},
+	{"keys", "[prefix]", "list the keys of the store", (*shell).keys, true, true},
+	{"query", "[flags] <query>", "run a query; query -h lists its flags", (*shell).query, false, true},
+	{"stats", "", "show the latency and request charge of the commands so far", (*shell).stats, false, false},
+	{"timing", "[on|off]", "show the latency and request charge of each command", (*shell).timing, false, false},
+	{"help", "", "list the commands", nil, false, false},
+	{"exit", "", "leave the shell; so does Ctrl-D", nil, false, false},
+}
+
+// shell is an interactive shell on the session's container, working in one
+// store at a time.
+type shell struct {
+	s         *session
+	out       io.Writer
+	showTimes bool
+	// known holds the keys of the store seen in the latest listing and in
+	// reads and writes since, which tab completes.
+	known map[string]bool
+	// stores holds the stores used, which tab completes after use.
+	stores  []string
+	results map[string]*commandStats
+}
+
+// commandStats sums up the runs of one shell command.
+type commandStats struct {
+	runs, errors int
+	total, max   time.Duration
+	charge       float64
+}
+
+func setupShell(fs *flag.FlagSet) runFunc {
+	history := fs.String("history", defaultHistoryPath(), "keep the command history in `file`; empty keeps none")
+	return func(ctx context.Context, s *session, args []string) error {
+		if len(args) != 0 {
+			return usageError("unexpected arguments")
+		}
+		// Ctrl-C cancels the running command rather than the shell.
+		signal.Reset(os.Interrupt)
+
+		sh := newShell(s)
+		ed := newLineEditor(os.Stdin, os.Stdout, sh.complete)
+		var historyFile *os.File
+		if ed.terminal && *history != "" {
+			var err error
+			if historyFile, err = loadHistory(*history, ed); err != nil {
+				fmt.Fprintf(s.errOut, "Not keeping history: %v\n", err)
+			} else {
+				defer historyFile.Close()
+			}
+			fmt.Fprintf(sh.out, "Connected to %s/%s. Type help for the commands.\n", s.conn.database, s.conn.container)
+		}
+		return sh.run(ctx, ed, historyFile)
+	}
+}
+
+func newShell(s *session) *shell {
+	return &shell{
+		s:       s,
+		out:     s.out,
+		known:   map[string]bool{},
+		stores:  []string{s.store.StoreID()},
+		results: map[string]*commandStats{},
+	}
+}
+
+// run executes the lines read by ed until the input ends or a line exits the
+// shell. Lines are appended to historyFile unless it is nil.
+func (sh *shell) run(ctx context.Context, ed *lineEditor, historyFile *os.File) error {
+	for {
+		line, err := ed.readLine(sh.s.store.StoreID() + "> ")
+		switch {
+		case errors.Is(err, errInterrupted):
+			continue
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if ed.addHistory(line) && historyFile != nil {
+			fmt.Fprintln(historyFile, line)
+		}
+		if sh.execute(ctx, line) {
+			return nil
+		}
+	}
+}
+
+// defaultHistoryPath returns ~/.cosmos_history, or nothing if there is no
+// home directory.
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cosmos_history")
+}
+
+// loadHistory adds the lines of the history file at path to the editor's
+// history and opens the file to append to it. A file longer than the history
+// kept is first rewritten with only its last lines.
+func loadHistory(path string, ed *lineEditor) (*os.File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, line := range lines {
+		ed.addHistory(line)
+	}
+	if len(lines) > maxHistory {
+		trimmed := strings.Join(ed.history, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(trimmed), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+}
+
+// execute runs a line of input and reports whether the shell should exit.
+func (sh *shell) execute(ctx context.Context, line string) bool {
+	name, rest, _, err := nextWord(line)
+	if err != nil {
+		fmt.Fprintf(sh.out, "Error: %v\n", err)
+		return false
+	}
+	switch name {
+	case "exit", "quit":
+		return true
+	case "help":
+		sh.help()
+		return false
+	}
+	i := slices.IndexFunc(shellCommands, func(c shellCommand) bool { return c.name == name })
+	if i < 0 {
+		fmt.Fprintf(sh.out, "Unknown command %q; type help for the commands\n", name)
+		return false
+	}
+	cmd := &shellCommands[i]
+	// The query is taken as typed, so that its quotes survive.
+	var args []string
+	if name == "query" {
+		args = []string{rest}
+	} else if args, err = splitWords(rest); err != nil {
+		fmt.Fprintf(sh.out, "Error: %v\n", err)
+		return false
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	start, charge := time.Now(), sh.s.charges.total()
+	err = cmd.run(sh, ctx, args)
+	elapsed, charge := time.Since(start), sh.s.charges.total()-charge
+
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(sh.out, "%v\nUsage: %s %s\n", err, cmd.name, cmd.args)
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(sh.out, "Error: %v\n", err)
+	}
+	if cmd.remote {
+		r := sh.results[name]
+		if r == nil {
+			r = &commandStats{}
+			sh.results[name] = r
+		}
+		r.runs++
+		r.total += elapsed
+		r.max = max(r.max, elapsed)
+		r.charge += charge
+		if err != nil {
+			r.errors++
+		}
+		if sh.showTimes {
+			fmt.Fprintf(sh.out, "Time: %v, %.2f RU\n", elapsed.Round(10*time.Microsecond), charge)
+		}
+	}
+	return false
+}
+
+func (sh *shell) help() {
+	tw := tabwriter.NewWriter(sh.out, 0, 0, 2, ' ', 0)
+	for _, cmd := range shellCommands {
+		fmt.Fprintf(tw, "%s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	tw.Flush()
+}
+
+// complete completes command names, keys seen recently, stores used and the
+// argument of timing.
+func (sh *shell) complete(args []string, word string) []string {
+	var candidates []string
+	switch {
+	case len(args) == 0:
+		for _, cmd := range shellCommands {
+			candidates = append(candidates, cmd.name)
+		}
+	case len(args) == 1 && args[0] == "use":
+		candidates = sh.stores
+	case len(args) == 1 && args[0] == "timing":
+		candidates = []string{"on", "off"}
+	case len(args) == 1:
+		i := slices.IndexFunc(shellCommands, func(c shellCommand) bool { return c.name == args[0] })
+		if i >= 0 && shellCommands[i].keyArg {
+			candidates = slices.Collect(maps.Keys(sh.known))
+		}
+	}
+	candidates = slices.DeleteFunc(slices.Clone(candidates), func(c string) bool { return !strings.HasPrefix(c, word) })
+	slices.Sort(candidates)
+	return slices.Compact(candidates)
+}
+
+func (sh *shell) use(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return usageError("expected one store")
+	}
+	sh.s.store = NewKeyValueStore(sh.s.container, args[0])
+	clear(sh.known)
+	if !slices.Contains(sh.stores, args[0]) {
+		sh.stores = append(sh.stores, args[0])
+	}
+	return nil
+}
+
+func (sh *shell) get(ctx context.Context, args []string) error {
+	key, err := keyArg(args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opContext(ctx, sh.s.conn.opTimeout)
+	defer cancel()
+	value, found, err := sh.s.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		delete(sh.known, key)
+		fmt.Fprintln(sh.out, "(not found)")
+		return nil
+	}
+	sh.known[key] = true
+	sh.out.Write(value)
+	if len(value) == 0 || value[len(value)-1] != '\n' {
+		fmt.Fprintln(sh.out)
+	}
+	return nil
+}
+
+func (sh *shell) set(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return usageError("expected a key and a value")
+	}
+	ctx, cancel := opContext(ctx, sh.s.conn.opTimeout)
+	defer cancel()
+	if err := sh.s.store.Set(ctx, args[0], []byte(args[1])); err != nil {
+		return err
+	}
+	sh.known[args[0]] = true
+	return nil
+}
+
+func (sh *shell) delete(ctx context.Context, args []string) error {
+	key, err := keyArg(args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opContext(ctx, sh.s.conn.opTimeout)
+	defer cancel()
+	if err := sh.s.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	delete(sh.known, key)
+	return nil
+}
+
+func (sh *shell) exists(ctx context.Context, args []string) error {
+	key, err := keyArg(args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := opContext(ctx, sh.s.conn.opTimeout)
+	defer cancel()
+	found, err := sh.s.store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if found {
+		sh.known[key] = true
+	} else {
+		delete(sh.known, key)
+	}
+	fmt.Fprintln(sh.out, found)
+	return nil
+}
+
+func (sh *shell) keys(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return usageError("expected at most one prefix")
+	}
+	ctx, cancel := opContext(ctx, sh.s.conn.opTimeout)
+	defer cancel()
+	keys, err := sh.s.store.GetKeys(ctx)
+	if err != nil {
+		return err
+	}
+	clear(sh.known)
+	slices.Sort(keys)
+	n := 0
+	for _, key := range keys {
+		sh.known[key] = true
+		if len(args) == 0 || strings.HasPrefix(key, args[0]) {
+			fmt.Fprintln(sh.out, key)
+			n++
+		}
+	}
+	plural := "s"
+	if n == 1 {
+		plural = ""
+	}
+	fmt.Fprintf(sh.out, "(%d key%s)\n", n, plural)
+	return nil
+}
+
+// query runs the query command. Its flags come first, since the query is the
+// rest of the line as typed. Results are printed as a table by default.
+func (sh *shell) query(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	run := setupQuery(fs)
+	fs.Set("format", FormatTable)
+	fs.Lookup("format").DefValue = FormatTable
+
+	var flags []string
+	rest := args[0]
+	for {
+		word, after, ok, err := nextWord(rest)
+		if err != nil {
+			return usageError(err.Error())
+		}
+		if !ok || !strings.HasPrefix(word, "-") {
+			break
+		}
+		flags, rest = append(flags, word), after
+		if word == "--" {
+			break
+		}
+		// A flag's value is the next word, unless it is a boolean flag or
+		// is written -flag=value.
+		name := strings.TrimLeft(word, "-")
+		if f := fs.Lookup(name); f != nil && !isBoolFlag(f) {
+			value, after, ok, err := nextWord(rest)
+			if err != nil {
+				return usageError(err.Error())
+			}
+			if ok {
+				flags, rest = append(flags, value), after
+			}
+		}
+	}
+	if err := fs.Parse(flags); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(sh.out)
+			fs.PrintDefaults()
+			return nil
+		}
+		return usageError(err.Error())
+	}
+	query := strings.TrimSpace(rest)
+	if query == "" {
+		return usageError("expected a query")
+	}
+	return run(ctx, sh.s, []string{query})
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func (sh *shell) stats(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return usageError("unexpected arguments")
+	}
+	if len(sh.results) == 0 {
+		fmt.Fprintln(sh.out, "No commands run yet")
+		return nil
+	}
+	tw := tabwriter.NewWriter(sh.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Command\tRuns\tErrors\tMean\tMax\tRU\t")
+	var total commandStats
+	for _, name := range slices.Sorted(maps.Keys(sh.results)) {
+		r := sh.results[name]
+		printCommandStats(tw, name, r)
+		total.runs += r.runs
+		total.errors += r.errors
+		total.total += r.total
+		total.max = max(total.max, r.max)
+		total.charge += r.charge
+	}
+	printCommandStats(tw, "total", &total)
+	return tw.Flush()
+}
+
+func printCommandStats(w io.Writer, name string, r *commandStats) {
+	mean := r.total / time.Duration(r.runs)
+	fmt.Fprintf(w, "%s\t%d\t%d\t%v\t%v\t%.2f\t\n", name, r.runs, r.errors,
+		mean.Round(10*time.Microsecond), r.max.Round(10*time.Microsecond), r.charge)
+}
+
+func (sh *shell) timing(ctx context.Context, args []string) error {
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "on":
+		sh.showTimes = true
+	case len(args) == 1 && args[0] == "off":
+		sh.showTimes = false
+	default:
+		return usageError("expected on or off")
+	}
+	state := "off"
+	if sh.showTimes {
+		state = "on"
+	}
+	fmt.Fprintf(sh.out, "Timing is %s\n", state)
+	return nil
+}
+
+// chargeMeter is a pipeline policy that adds up the request charge of every
+// response, so that the shell can report what each command cost.
+type chargeMeter struct {
+	mu     sync.Mutex
+	charge float64
+}
+
+func (m *chargeMeter) Do(req *policy.Request) (*http.Response, error) {
+	resp, err := req.Next()
+	if resp != nil {
+		if charge, err := strconv.ParseFloat(resp.Header.Get("x-ms-request-charge"), 64); err == nil {
+			m.mu.Lock()
+			m.charge += charge
+			m.mu.Unlock()
+		}
+	}
+	return resp, err
+}
+
+// total returns the charge of every response so far.
+func (m *chargeMeter) total() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.charge
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scriptedShell returns a shell on a store of a new fake, printing to out,
+// and a line editor reading script as if it were piped in.
+func scriptedShell(t *testing.T, script string) (*shell, *lineEditor, *strings.Builder) {
+	t.Helper()
+	container, _ := fakeContainer(t)
+	out := &strings.Builder{}
+	sh := newShell(testSession(NewKeyValueStore(container, "shell"), out, io.Discard))
+	ed := &lineEditor{in: bufio.NewReader(strings.NewReader(script)), out: out, complete: sh.complete}
+	return sh, ed, out
+}
+
+func TestShellScript(t *testing.T) {
+	sh, ed, out := scriptedShell(t, strings.Join([]string{
+		"set a one",
+		`set "b c" 'two words'`,
+		"",
+		"get a",
+		`get "b c"`,
+		"get missing",
+		"exists a",
+		"keys",
+		"delete a",
+		"keys b",
+		"use other",
+		"keys",
+		"use shell",
+		"keys",
+		"get",
+		"set 'a",
+		"fetch a",
+		"exit",
+		"set after exit",
+	}, "\n"))
+	if err := sh.run(testContext(t), ed, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"one",
+		"two words",
+		"(not found)",
+		"true",
+		"a",
+		"b c",
+		"(2 keys)",
+		"b c",
+		"(1 key)",
+		"(0 keys)",
+		"b c",
+		"(1 key)",
+		"expected one key",
+		"Usage: get <key>",
+		"Error: unterminated ' quote",
+		`Unknown command "fetch"; type help for the commands`,
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("shell printed:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if _, found, err := sh.s.store.Get(testContext(t), "after"); found || err != nil {
+		t.Errorf("a line after exit ran: found %v, %v", found, err)
+	}
+	// Blank lines are not kept in the history.
+	if len(ed.history) != 17 || ed.history[16] != "exit" {
+		t.Errorf("history = %q, want 17 lines up to exit", ed.history)
+	}
+
+	// The keys listed since the last use complete, and so do the stores
+	// used.
+	if got := sh.complete([]string{"get"}, ""); !slices.Equal(got, []string{"b c"}) {
+		t.Errorf("keys completed = %q, want the one left", got)
+	}
+	if got := sh.complete([]string{"use"}, ""); !slices.Equal(got, []string{"other", "shell"}) {
+		t.Errorf("stores completed = %q", got)
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	sh, _, _ := scriptedShell(t, "")
+	sh.known = map[string]bool{"apple": true, "apricot": true, "banana": true}
+	sh.stores = []string{"shell", "other"}
+	tests := []struct {
+		args []string
+		word string
+		want []string
+	}{
+		{nil, "e", []string{"exists", "exit"}},
+		{nil, "", []string{"delete", "exists", "exit", "get", "help", "keys", "query", "set", "stats", "timing", "use"}},
+		{nil, "x", nil},
+		{[]string{"get"}, "ap", []string{"apple", "apricot"}},
+		{[]string{"delete"}, "", []string{"apple", "apricot", "banana"}},
+		{[]string{"set"}, "b", []string{"banana"}},
+		// Only the first argument is a key.
+		{[]string{"set", "apple"}, "b", nil},
+		{[]string{"query"}, "a", nil},
+		{[]string{"use"}, "", []string{"other", "shell"}},
+		{[]string{"timing"}, "o", []string{"off", "on"}},
+		{[]string{"stats"}, "", nil},
+	}
+	for _, tt := range tests {
+		if got := sh.complete(tt.args, tt.word); !slices.Equal(got, tt.want) {
+			t.Errorf("complete(%q, %q) = %q, want %q", tt.args, tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuery(t *testing.T) {
+	ctx := testContext(t)
+	sh, _, out := scriptedShell(t, "")
+	for _, key := range []string{"a", "a b", "c"} {
+		if err := sh.s.store.Set(ctx, key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewKeyValueStore(sh.s.container, "other").Set(ctx, "o", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		// Results are a table by default, and the query keeps its quotes.
+		{`query SELECT c.id FROM c WHERE c.id = 'a b'`, "id\na b\n"},
+		{`query -format ndjson SELECT c.id FROM c WHERE c.id = "a b"`, `{"id":"a b"}` + "\n"},
+		{`query -format=ndjson SELECT c.id FROM c WHERE c.id = "a b"`, `{"id":"a b"}` + "\n"},
+		// A flag's value may be quoted.
+		{`query -pk 'other' SELECT VALUE c.id FROM c`, "(value)\no\n"},
+		{`query -pk other -format json SELECT VALUE c.id FROM c`, "[\n  \"o\"\n]\n"},
+		// A boolean flag takes no value.
+		{`query -cross-partition -format ndjson SELECT VALUE COUNT(1) FROM c`, "4\n"},
+		{`query -max-items 1 -max-pages 2 -format ndjson SELECT VALUE c.id FROM c ORDER BY c.id`, "\"a\"\n\"a b\"\n"},
+		// -- ends the flags.
+		{`query -format ndjson -- SELECT VALUE c.id FROM c WHERE c.id = "c"`, "\"c\"\n"},
+		{`query -pk other`, "expected a query\nUsage: query [flags] <query>\n"},
+		{`query -bogus SELECT 1`, "flag provided but not defined: -bogus\nUsage: query [flags] <query>\n"},
+		{`query -pk 'other SELECT 1`, "unterminated ' quote\nUsage: query [flags] <query>\n"},
+		{`query -pk a -cross-partition SELECT 1`, "-pk and -cross-partition are mutually exclusive\nUsage: query [flags] <query>\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		sh.execute(ctx, tt.line)
+		if out.String() != tt.want {
+			t.Errorf("%s printed:\n%s\nwant:\n%s", tt.line, out.String(), tt.want)
+		}
+	}
+
+	out.Reset()
+	sh.execute(ctx, "query -h")
+	if !strings.Contains(out.String(), "-cross-partition") || !strings.Contains(out.String(), `(default "table")`) {
+		t.Errorf("query -h printed:\n%s", out.String())
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// Pair is the item written by the store.
+type Pair struct {
+	ID      string `json:"id"`
+	Value   []byte `json:"value"`
+	StoreID string `json:"store_id"`
+}
+
+// KeyValueStore is a key-value store backed by a Cosmos DB container, ported
+// from the Rust KeyValueAzureCosmos store. All items of a store share the
+// store_id partition key, so one container can hold many stores.
+type KeyValueStore struct {
+	client      *azcosmos.ContainerClient
+	storeID     string
+	pk          azcosmos.PartitionKey
+	decodeValue valueDecoder
+}
+
+// NewKeyValueStore returns the store storeID in the container.
+func NewKeyValueStore(client *azcosmos.ContainerClient, storeID string) *KeyValueStore {
+	return &KeyValueStore{
+		client:      client,
+		storeID:     storeID,
+		pk:          azcosmos.NewPartitionKeyString(storeID),
+		decodeValue: decodeValueLazy,
+	}
+}
+
+// StoreID returns the partition key value shared by every item of the store.
+func (s *KeyValueStore) StoreID() string {
+	return s.storeID
+}
+
+// Get returns the value of key. found is false if the key does not exist.
+func (s *KeyValueStore) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	item, found, err := s.getItem(ctx, key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	value, err = s.decodeValue(item)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set creates or replaces key.
+func (s *KeyValueStore) Set(ctx context.Context, key string, value []byte) error {
+	item, err := json.Marshal(Pair{ID: key, Value: value, StoreID: s.storeID})
+	if err != nil {
+		return err
+	}
+	return s.upsertItem(ctx, item)
+}
+
+// getItem returns the raw JSON item of key.
+func (s *KeyValueStore) getItem(ctx context.Context, key string) (item []byte, found bool, err error) {
+	response, err := s.client.ReadItem(ctx, s.pk, key, nil)
+	if isNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return response.Value, true, nil
+}
+
+// upsertItem creates or replaces a raw JSON item of the store.
+func (s *KeyValueStore) upsertItem(ctx context.Context, item []byte) error {
+	_, err := s.client.UpsertItem(ctx, s.pk, item, nil)
+	return err
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *KeyValueStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteItem(ctx, s.pk, key, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Exists reports whether key exists.
+func (s *KeyValueStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, found, err := s.Get(ctx, key)
+	return found, err
+}
+
+// GetKeys returns every key of the store.
+func (s *KeyValueStore) GetKeys(ctx context.Context) ([]string, error) {
+	return s.getKeys(ctx, 0)
+}
+
+// getKeys is GetKeys with each page of the listing, rather than the whole of
+// it, bounded by pageTimeout.
+func (s *KeyValueStore) getKeys(ctx context.Context, pageTimeout time.Duration) ([]string, error) {
+	query := "SELECT c.id FROM c WHERE c.store_id = @store_id"
+	queryOptions := azcosmos.QueryOptions{
+		QueryParameters: []azcosmos.QueryParameter{{Name: "@store_id", Value: s.storeID}},
+	}
+
+	type idOnly struct {
+		ID string `json:"id"`
+	}
+	var keys []string
+	for pair, err := range queryItems[idOnly](ctx, s.client, query, s.pk, &queryOptions, pageTimeout) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pair.ID)
+	}
+	return keys, nil
+}
+
+// GetMany returns the values of keys, omitting keys that do not exist.
+func (s *KeyValueStore) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, found, err := s.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// SetMany sets every key of values.
+func (s *KeyValueStore) SetMany(ctx context.Context, values map[string][]byte) error {
+	for key, value := range values {
+		if err := s.Set(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteMany removes keys.
+func (s *KeyValueStore) DeleteMany(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := s.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// isThrottled reports whether err is a 429 that outlasted the SDK's retries.
+func isThrottled(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusTooManyRequests
+}
+
+// statusCode returns the HTTP status of a failed request, or 0.
+func statusCode(err error) int {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+// TypedStoreOptions configures a TypedStore.
+type TypedStoreOptions struct {
+	// DisallowUnknownFields makes decoding fail when a stored value has
+	// fields that T does not declare.
+	DisallowUnknownFields bool
+}
+
+// TypedStore stores values of type T in a KeyValueStore. Unlike the base64
+// encoded []byte values of the KeyValueStore, T is written as a native JSON
+// value, so its fields can be used in queries, for example
+// c.value.owner = @owner.
+type TypedStore[T any] struct {
+	kv     *KeyValueStore
+	strict bool
+}
+
+// typedItem is the item written by a TypedStore.
+type typedItem struct {
+	ID      string          `json:"id"`
+	Value   json.RawMessage `json:"value"`
+	StoreID string          `json:"store_id"`
+}
+
+// NewTypedStore layers a TypedStore over kv. o may be nil.
+func NewTypedStore[T any](kv *KeyValueStore, o *TypedStoreOptions) *TypedStore[T] {
+	s := &TypedStore[T]{kv: kv}
+	if o != nil {
+		s.strict = o.DisallowUnknownFields
+	}
+	return s
+}
+
+// Get returns the value of key. found is false if the key does not exist.
+func (s *TypedStore[T]) Get(ctx context.Context, key string) (value T, found bool, err error) {
+	raw, found, err := s.kv.getItem(ctx, key)
+	if !found || err != nil {
+		return value, found, err
+	}
+	var item typedItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return value, false, err
+	}
+	value, err = s.decode(key, item.Value)
+	if err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+// Set creates or replaces key.
+func (s *TypedStore[T]) Set(ctx context.Context, key string, value T) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode value of %s: %w", key, err)
+	}
+	item, err := json.Marshal(typedItem{ID: key, Value: encoded, StoreID: s.kv.storeID})
+	if err != nil {
+		return err
+	}
+	return s.kv.upsertItem(ctx, item)
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (s *TypedStore[T]) Delete(ctx context.Context, key string) error {
+	return s.kv.Delete(ctx, key)
+}
+
+// Exists reports whether key exists.
+func (s *TypedStore[T]) Exists(ctx context.Context, key string) (bool, error) {
+	_, found, err := s.kv.getItem(ctx, key)
+	return found, err
+}
+
+// GetKeys returns every key of the store.
+func (s *TypedStore[T]) GetKeys(ctx context.Context) ([]string, error) {
+	return s.kv.GetKeys(ctx)
+}
+
+// Entry is a key of a TypedStore and its value.
+type Entry[T any] struct {
+	Key   string
+	Value T
+}
+
+// Query yields every entry of the store matching filter, a condition on the
+// item c such as "c.value.owner = @owner". Errors end the sequence, as with
+// QueryItems.
+func (s *TypedStore[T]) Query(ctx context.Context, filter string, params ...azcosmos.QueryParameter) iter.Seq2[Entry[T], error] {
+	query := "SELECT * FROM c WHERE c.store_id = @store_id AND (" + filter + ")"
+	queryOptions := azcosmos.QueryOptions{
+		QueryParameters: append([]azcosmos.QueryParameter{{Name: "@store_id", Value: s.kv.storeID}}, params...),
+	}
+	return func(yield func(Entry[T], error) bool) {
+		for item, err := range QueryItems[typedItem](ctx, s.kv.client, query, s.kv.pk, &queryOptions) {
+			if err != nil {
+				yield(Entry[T]{}, err)
+				return
+			}
+			value, err := s.decode(item.ID, item.Value)
+			if err != nil {
+				yield(Entry[T]{}, err)
+				return
+			}
+			if !yield(Entry[T]{Key: item.ID, Value: value}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *TypedStore[T]) decode(key string, raw json.RawMessage) (T, error) {
+	var value T
+	if len(raw) == 0 {
+		return value, fmt.Errorf("decode value of %s: item has no value", key)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if s.strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&value); err != nil {
+		return value, fmt.Errorf("decode value of %s: %w", key, err)
+	}
+	return value, nil
+}
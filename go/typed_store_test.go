@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/azcosmos"
+)
+
+type task struct {
+	Owner string   `json:"owner"`
+	Done  bool     `json:"done"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestTypedStore(t *testing.T) {
+	ctx := testContext(t)
+	container, _ := fakeContainer(t)
+	kv := NewKeyValueStore(container, "tasks")
+	tasks := NewTypedStore[task](kv, nil)
+
+	want := map[string]task{
+		"t1": {Owner: "ada", Tags: []string{"a", "b"}},
+		"t2": {Owner: "bob", Done: true},
+		"t3": {Owner: "ada", Done: true},
+	}
+	for key, value := range want {
+		if err := tasks.Set(ctx, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, value := range want {
+		got, found, err := tasks.Get(ctx, key)
+		if err != nil || !found || got.Owner != value.Owner || got.Done != value.Done || !slices.Equal(got.Tags, value.Tags) {
+			t.Errorf("Get(%s) = %+v, %v, %v; want %+v, true, nil", key, got, found, err, value)
+		}
+	}
+	if got, found, err := tasks.Get(ctx, "missing"); err != nil || found {
+		t.Errorf("Get(missing) = %+v, %v, %v; want not found", got, found, err)
+	}
+
+	// The value is stored as JSON, not base64, so the raw item has its
+	// fields.
+	raw, _, err := kv.getItem(ctx, "t2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item struct {
+		Value map[string]any `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &item); err != nil || item.Value["owner"] != "bob" || item.Value["done"] != true {
+		t.Errorf("item t2 = %s, %v; want its value as a JSON object", raw, err)
+	}
+
+	tests := []struct {
+		filter string
+		params []azcosmos.QueryParameter
+		want   []string
+	}{
+		{"c.value.owner = @owner", []azcosmos.QueryParameter{{Name: "@owner", Value: "ada"}}, []string{"t1", "t3"}},
+		{"c.value.done AND c.value.owner = @owner", []azcosmos.QueryParameter{{Name: "@owner", Value: "ada"}}, []string{"t3"}},
+		{"NOT c.value.done", nil, []string{"t1"}},
+		{"c.value.owner = 'eve'", nil, nil},
+	}
+	for _, tt := range tests {
+		var keys []string
+		for entry, err := range tasks.Query(ctx, tt.filter, tt.params...) {
+			if err != nil {
+				t.Fatalf("Query(%q): %v", tt.filter, err)
+			}
+			if w := want[entry.Key]; entry.Value.Owner != w.Owner || entry.Value.Done != w.Done {
+				t.Errorf("Query(%q) yielded %s = %+v, want %+v", tt.filter, entry.Key, entry.Value, want[entry.Key])
+			}
+			keys = append(keys, entry.Key)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("Query(%q) keys = %q, want %q", tt.filter, keys, tt.want)
+		}
+	}
+
+	if err := tasks.Delete(ctx, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := tasks.Exists(ctx, "t1"); err != nil || found {
+		t.Errorf("Exists(t1) after Delete = %v, %v; want false, nil", found, err)
+	}
+}
+
+func TestTypedStoreUnknownFields(t *testing.T) {
+	ctx := testContext(t)
+	container, _ := fakeContainer(t)
+	kv := NewKeyValueStore(container, "tasks")
+	item := []byte(`{"id": "t1", "store_id": "tasks", "value": {"owner": "ada", "priority": 2}}`)
+	if _, err := container.UpsertItem(ctx, kv.pk, item, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lenient := NewTypedStore[task](kv, nil)
+	if got, found, err := lenient.Get(ctx, "t1"); err != nil || !found || got.Owner != "ada" {
+		t.Errorf("lenient Get(t1) = %+v, %v, %v; want owner ada", got, found, err)
+	}
+
+	strict := NewTypedStore[task](kv, &TypedStoreOptions{DisallowUnknownFields: true})
+	if _, found, err := strict.Get(ctx, "t1"); err == nil || found || !strings.Contains(err.Error(), `unknown field "priority"`) {
+		t.Errorf("strict Get(t1) = %v, %v; want an unknown field error", found, err)
+	}
+	var errs []error
+	for _, err := range strict.Query(ctx, "true") {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil || !strings.Contains(errs[0].Error(), "decode value of t1") {
+		t.Errorf("strict Query yielded errors %v, want decode value of t1", errs)
+	}
+}